@@ -1,15 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-03-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/msi/mgmt/2018-11-30/msi"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-03-01/network"
 	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2021-04-01/storage"
 	"github.com/Azure/azure-sdk-for-go/services/virtualmachineimagebuilder/mgmt/2020-02-14/virtualmachineimagebuilder"
 	"github.com/Azure/go-autorest/autorest"
@@ -21,7 +24,6 @@ import (
 
 	"github.com/yaegashi/customazed/store"
 	"github.com/yaegashi/customazed/utils/inpututil"
-	"github.com/yaegashi/customazed/utils/reflectutil"
 	"github.com/yaegashi/customazed/utils/ssutil"
 )
 
@@ -61,8 +63,13 @@ type App struct {
 	Auth           string
 	AuthFile       string
 	AuthDev        string
+	Cell           string
 	Quiet          bool
 	NoLogin        bool
+	NoPrompt       bool
+	LogPrefix      string
+	MatrixCell     *MatrixCell
+	BuilderInput   string
 
 	_ARMToken         *adal.ServicePrincipalToken
 	_StorageToken     *adal.ServicePrincipalToken
@@ -74,7 +81,9 @@ type App struct {
 	_Image            *compute.Image
 	_Gallery          *compute.Gallery
 	_GalleryImage     *compute.GalleryImage
+	_Subnet           *network.Subnet
 	_HashNS           uuid.UUID
+	_InputsHashing    bool
 }
 
 // Cmd returns Command for app
@@ -95,6 +104,7 @@ func (app *App) Cmd() *cobra.Command {
 	cmd.PersistentFlags().StringVarP(&app.Auth, "auth", "", "", envHelp("auth source [dev,env,file]", environAuth, defaultAuth))
 	cmd.PersistentFlags().StringVarP(&app.AuthFile, "auth-file", "", "", envHelp("auth file store", environAuthFile, defaultAuthFile))
 	cmd.PersistentFlags().StringVarP(&app.AuthDev, "auth-dev", "", "", envHelp("auth dev store", environAuthDev, defaultAuthDev))
+	cmd.PersistentFlags().StringVarP(&app.Cell, "cell", "", "", "matrix cell name")
 	cmd.PersistentFlags().BoolVarP(&app.Quiet, "quiet", "q", false, "quiet")
 	cmd.PersistentFlags().BoolVarP(&app.NoLogin, "no-login", "", false, "disable login")
 	return cmd
@@ -112,6 +122,13 @@ func (app *App) PersistentPreRunE(cmd *cobra.Command, args []string) error {
 	app.AuthDev = ssutil.FirstNonEmpty(app.AuthDev, os.Getenv(environAuthDev), defaultAuthDev)
 	app.AuthFile = ssutil.FirstNonEmpty(app.AuthFile, os.Getenv(environAuthFile), defaultAuthFile)
 
+	// Builder commands hash their own input with inputsHash
+	if cmd.Parent() != nil && cmd.Parent().Name() == "builder" {
+		if f := cmd.Flags().Lookup("input"); f != nil {
+			app.BuilderInput = f.Value.String()
+		}
+	}
+
 	store, err := store.NewStore(app.ConfigDir)
 	if err != nil {
 		return err
@@ -129,23 +146,32 @@ func (app *App) PersistentPreRunE(cmd *cobra.Command, args []string) error {
 	app.ConfigLoad.SubscriptionID = ssutil.FirstNonEmpty(app.SubscriptionID, os.Getenv(auth.SubscriptionID), app.ConfigLoad.SubscriptionID, defaultSubscriptionID)
 	app.ConfigLoad.HashNS = ssutil.FirstNonEmpty(app.HashNS, os.Getenv(environHashNS), app.ConfigLoad.HashNS, uuid.New().String())
 
-	tv := app.NewTemplateVariable(DisabledStorageUploader(fmt.Sprintf("upload: forbidden in %s", app.ConfigFile)))
-
-	hashNS, err := tv.Execute(app.ConfigLoad.HashNS)
-	if err != nil {
-		return err
-	}
-	app._HashNS = uuid.NewSHA1(initialHashNS, []byte(hashNS))
-
-	cfg := reflectutil.Clone(app.ConfigLoad)
-	err = tv.Resolve(cfg)
-	if err != nil {
-		return err
+	var cell *MatrixCell
+	if cells := app.ConfigLoad.MatrixCells(); len(cells) > 0 {
+		if app.Cell == "" {
+			// Commands with --all resolve each cell by themselves
+			all := cmd.Flags().Lookup("all")
+			if len(cells) > 1 && (all == nil || all.Value.String() != "true") {
+				var names []string
+				for _, c := range cells {
+					names = append(names, c.Name)
+				}
+				return fmt.Errorf("matrix has %d cells: specify --cell (%s) or --all where supported", len(cells), strings.Join(names, ", "))
+			}
+			cell = &cells[0]
+			app.Logf("Matrix cell: %s", cell.Name)
+		} else {
+			cell, err = app.ConfigLoad.MatrixCell(app.Cell)
+			if err != nil {
+				return err
+			}
+			app.Logf("Matrix cell: %s", cell.Name)
+		}
+	} else if app.Cell != "" {
+		return fmt.Errorf("no matrix in %s", app.ConfigFile)
 	}
 
-	app.Config = cfg.(*Config)
-
-	return nil
+	return app.ResolveConfig(cell)
 }
 
 // HashID returns UUIDv5 by hashing strings
@@ -314,24 +340,49 @@ func (app *App) AuthorizeDeviceFlow() (*adal.ServicePrincipalToken, error) {
 	return token, nil
 }
 
+// WaitForFuture calls FutureAPI function with specified timeout
+func (app *App) WaitForFuture(ctx context.Context, future azure.FutureAPI, client autorest.Client, timeout string) error {
+	if timeout != "" {
+		duration, err := time.ParseDuration(timeout)
+		if err != nil {
+			return err
+		}
+		if duration == 0 {
+			return nil
+		}
+		client.PollingDuration = duration
+	}
+	app.Logf("Waiting for completion... (checking every %s up to %s)", client.PollingDelay, client.PollingDuration)
+	err := future.WaitForCompletionRef(ctx, client)
+	if err != nil {
+		aErr, ok := err.(autorest.DetailedError)
+		if !ok || aErr.Original != context.DeadlineExceeded {
+			return err
+		}
+		return fmt.Errorf("timed out")
+	}
+	app.Logf("Done")
+	return nil
+}
+
 // Log is logging function with log.Print
 func (app *App) Log(args ...interface{}) {
 	if !app.Quiet {
-		log.Print(args...)
+		log.Print(append([]interface{}{app.LogPrefix}, args...)...)
 	}
 }
 
 // Logln is logging function with log.Println
 func (app *App) Logln(args ...interface{}) {
 	if !app.Quiet {
-		log.Println(args...)
+		log.Print(app.LogPrefix + fmt.Sprintln(args...))
 	}
 }
 
 // Logf is logging function with log.Printf
 func (app *App) Logf(format string, args ...interface{}) {
 	if !app.Quiet {
-		log.Printf(format, args...)
+		log.Printf(app.LogPrefix+format, args...)
 	}
 }
 
@@ -340,7 +391,7 @@ func (app *App) Dump(v interface{}) {
 	if !app.Quiet {
 		b, err := json.MarshalIndent(v, "", "  ")
 		if err == nil {
-			log.Printf("\n%s", string(b))
+			log.Printf("%s\n%s", app.LogPrefix, string(b))
 		}
 	}
 }
@@ -349,9 +400,11 @@ func (app *App) Dump(v interface{}) {
 func (app *App) Prompt(args ...interface{}) {
 	if !app.Quiet {
 		if len(args) > 0 {
-			log.Printf(args[0].(string), args[1:]...)
+			log.Printf(app.LogPrefix+args[0].(string), args[1:]...)
+		}
+		if !app.NoPrompt {
+			fmt.Fprint(os.Stdout, "Press ENTER to proceed: ")
+			fmt.Scanln()
 		}
-		fmt.Fprint(os.Stdout, "Press ENTER to proceed: ")
-		fmt.Scanln()
 	}
 }
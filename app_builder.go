@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"time"
+	"strings"
+	"sync"
 
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/azure"
@@ -11,10 +13,17 @@ import (
 	cmder "github.com/yaegashi/cobra-cmder"
 )
 
+const (
+	defaultBuilderInput    = "customazed_builder.json"
+	defaultBuilderParallel = 4
+)
+
 // AppBuilder is app builder command
 type AppBuilder struct {
 	*App
-	Timeout string
+	Timeout     string
+	PinSource   bool
+	ManifestTag bool
 }
 
 // AppBuilderCmder returns Cmder for app builder
@@ -40,25 +49,83 @@ func (app *AppBuilder) LogBuilderName() {
 
 // WaitForCompletion calls FutureAPI function with proper timeout setting
 func (app *AppBuilder) WaitForCompletion(ctx context.Context, future azure.FutureAPI, client autorest.Client) error {
-	if app.Timeout != "" {
-		duration, err := time.ParseDuration(app.Timeout)
+	return app.WaitForFuture(ctx, future, client, app.Timeout)
+}
+
+// ParallelFlag adds --parallel flag for ForEachCell with the same default to builder subcommands
+func ParallelFlag(cmd *cobra.Command, parallel *int) {
+	cmd.Flags().IntVarP(parallel, "parallel", "", defaultBuilderParallel, "number of matrix cells to process at a time (0 means no limit)")
+}
+
+// ForEachCell calls f for all matrix cells concurrently up to parallel at a time (zero means no limit)
+func (app *AppBuilder) ForEachCell(ctx context.Context, parallel int, f func(*AppBuilder) error) error {
+	cells := app.ConfigLoad.MatrixCells()
+	if len(cells) == 0 {
+		return fmt.Errorf("no matrix in %s", app.ConfigFile)
+	}
+
+	// Obtain tokens before running cells so that they are shared
+	_, err := app.ARMToken()
+	if err != nil {
+		return err
+	}
+	if app.StorageValid() {
+		_, err = app.StorageToken()
 		if err != nil {
 			return err
 		}
-		if duration == 0 {
-			return nil
-		}
-		client.PollingDuration = duration
 	}
-	app.Logf("Waiting for completion... (checking every %s up to %s)", client.PollingDelay, client.PollingDuration)
-	err := future.WaitForCompletionRef(ctx, client)
-	if err != nil {
-		aErr, ok := err.(autorest.DetailedError)
-		if !ok || aErr.Original != context.DeadlineExceeded {
+
+	var names []string
+	builders := make([]*AppBuilder, len(cells))
+	for i, cell := range cells {
+		cellApp, err := app.MatrixApp(cell)
+		if err != nil {
 			return err
 		}
-		return fmt.Errorf("timed out")
+		cellApp.NoPrompt = true
+		builder := *app
+		builder.App = cellApp
+		builders[i] = &builder
+		names = append(names, fmt.Sprintf("%s (%s)", cell.Name, cellApp.Config.Builder.BuilderName))
+	}
+	app.Logf("Matrix cells: %s", strings.Join(names, ", "))
+
+	if parallel <= 0 {
+		parallel = len(cells)
+	}
+	sem := make(chan struct{}, parallel)
+	errs := make([]error, len(cells))
+	var wg sync.WaitGroup
+	for i := range builders {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			errs[i] = f(builders[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var failed []string
+	var firstErr error
+	for i, err := range errs {
+		if err != nil {
+			builders[i].Logf("Error: %s", err)
+			failed = append(failed, cells[i].Name)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	err = fmt.Errorf("%d of %d matrix cells failed: %s", len(failed), len(cells), strings.Join(failed, ", "))
+	var eErr *ExitError
+	if errors.As(firstErr, &eErr) {
+		return &ExitError{Code: eErr.Code, Err: err}
 	}
-	app.Logf("Done")
-	return nil
+	return err
 }
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/virtualmachineimagebuilder/mgmt/2020-02-14/virtualmachineimagebuilder"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+
+	"github.com/yaegashi/customazed/utils/azutil"
+)
+
+const defaultBuildTimeoutInMinutes = 240
+
+// AppBuilderBuild is app builder build command
+type AppBuilderBuild struct {
+	*AppBuilder
+	Input     string
+	Delete    bool
+	NoLogs    bool
+	IfChanged bool
+}
+
+// AppBuilderBuildCmder returns Cmder for app builder build
+func (app *AppBuilder) AppBuilderBuildCmder() cmder.Cmder {
+	return &AppBuilderBuild{AppBuilder: app}
+}
+
+// Cmd returns Command for app builder build
+func (app *AppBuilderBuild) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "build",
+		Short:        "Create image template, run image build and wait for completion",
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	cmd.Flags().StringVarP(&app.Input, "input", "i", defaultBuilderInput, "input file path")
+	cmd.Flags().BoolVarP(&app.PinSource, "pin-source", "", false, "resolve latest platform image version of source")
+	cmd.Flags().BoolVarP(&app.ManifestTag, "manifest-tag", "", false, "add build manifest hash to artifact tags")
+	cmd.Flags().BoolVarP(&app.Delete, "delete", "", false, "delete image template after build")
+	cmd.Flags().BoolVarP(&app.NoLogs, "no-logs", "", false, "disable streaming customization.log output")
+	cmd.Flags().BoolVarP(&app.IfChanged, "if-changed", "", false, "build only if source image or inputs changed since the last build (implies --pin-source)")
+	return cmd
+}
+
+// RunE is main routine for app builder build
+func (app *AppBuilderBuild) RunE(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	app.LogBuilderName()
+	if app.IfChanged {
+		app.PinSource = true
+		changed, err := app.CheckChanges(ctx, app.Input)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			app.Log("No changes in source image or inputs, skipping build")
+			return nil
+		}
+	}
+
+	templatesClient := virtualmachineimagebuilder.NewVirtualMachineImageTemplatesClient(app.Config.SubscriptionID)
+	templatesClient.Authorizer = authorizer
+
+	// Resolve and confirm the input before touching the existing image template
+	prepared, err := app.PrepareTemplate(ctx, app.Input)
+	if err != nil {
+		return err
+	}
+
+	// Image template cannot be updated, so replace the existing one
+	_, err = templatesClient.Get(ctx, app.Config.Builder.ResourceGroup, app.Config.Builder.BuilderName)
+	if err == nil {
+		err = app.DeleteTemplate(ctx)
+		if err != nil {
+			return err
+		}
+	} else if aErr := azutil.Error(err); aErr == nil || aErr.StatusCode != http.StatusNotFound {
+		return err
+	}
+
+	err = app.DeployTemplate(ctx, prepared)
+	if err != nil {
+		return err
+	}
+
+	template, err := templatesClient.Get(ctx, app.Config.Builder.ResourceGroup, app.Config.Builder.BuilderName)
+	if err != nil {
+		return err
+	}
+	buildTimeout := int32(defaultBuildTimeoutInMinutes)
+	if template.BuildTimeoutInMinutes != nil && *template.BuildTimeoutInMinutes > 0 {
+		buildTimeout = *template.BuildTimeoutInMinutes
+	}
+	// Allow extra time for distribution
+	templatesClient.PollingDuration = time.Duration(buildTimeout)*time.Minute + time.Hour
+
+	app.Log("Running image build...")
+	runFuture, err := templatesClient.Run(ctx, app.Config.Builder.ResourceGroup, app.Config.Builder.BuilderName)
+	if err != nil {
+		return err
+	}
+
+	logCtx, logCancel := context.WithCancel(ctx)
+	logDone := make(chan struct{})
+	go func() {
+		if !app.NoLogs {
+			app.FollowLogs(logCtx, os.Stdout)
+		}
+		close(logDone)
+	}()
+	runErr := app.WaitForCompletion(ctx, &runFuture, templatesClient.Client)
+	logCancel()
+	<-logDone
+
+	template, err = templatesClient.Get(ctx, app.Config.Builder.ResourceGroup, app.Config.Builder.BuilderName)
+	if err != nil {
+		return err
+	}
+	var runState virtualmachineimagebuilder.RunState
+	if template.LastRunStatus != nil {
+		runState = template.LastRunStatus.RunState
+		app.Dump(template.LastRunStatus)
+	}
+
+	err = app.UpdateManifestRun(ctx)
+	if err != nil {
+		app.Logf("Warning: manifest: %s", err)
+	}
+
+	if runState == virtualmachineimagebuilder.RunStateSucceeded || runState == virtualmachineimagebuilder.RunStatePartiallySucceeded {
+		err = app.ShowRunOutputs(ctx)
+		if err != nil {
+			return err
+		}
+		err = app.ApplyGalleryTargetRegions(ctx)
+		if err != nil {
+			return err
+		}
+		if app.VHDCopyConfigured() {
+			artifactURI, err := app.VHDArtifactURI(ctx)
+			if err != nil {
+				return err
+			}
+			blobURL, err := app.VHDCopy(ctx, artifactURI)
+			if err != nil {
+				return err
+			}
+			app.Logf("VHD: copied to %s", blobURL)
+		}
+	}
+
+	if app.Delete {
+		err = app.DeleteTemplate(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if runState == "" || runState == virtualmachineimagebuilder.RunStateRunning {
+		return runErr
+	}
+
+	return RunStateError(runState)
+}
+
+// FollowLogs writes the latest customization.log output until ctx is done
+func (app *AppBuilder) FollowLogs(ctx context.Context, w io.Writer) {
+	// Use another context so that the final output can be fetched after ctx is done
+	bgCtx := context.Background()
+	var containerURL *azblob.ContainerURL
+	var blobURL *azblob.AppendBlobURL
+	var offset int64
+	for {
+		done := ctx.Err() != nil
+		if containerURL == nil {
+			if c, err := app.BuilderLogContainer(bgCtx); err == nil {
+				containerURL = c
+			}
+		}
+		if containerURL != nil && blobURL == nil {
+			if items, err := app.BuilderLogBlobs(bgCtx, containerURL); err == nil && len(items) > 0 {
+				u := containerURL.NewAppendBlobURL(items[len(items)-1].Name)
+				blobURL = &u
+			}
+		}
+		if blobURL != nil {
+			var err error
+			offset, err = app.BuilderDownloadLog(bgCtx, *blobURL, offset, w)
+			if err != nil {
+				app.Logf("Warning: %s", err)
+			}
+		}
+		if done {
+			return
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/virtualmachineimagebuilder/mgmt/2020-02-14/virtualmachineimagebuilder"
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+
+	"github.com/yaegashi/customazed/utils/azutil"
+	"github.com/yaegashi/customazed/utils/jsondiff"
+	"github.com/yaegashi/customazed/utils/ssutil"
+)
+
+// AppBuilderCheckSource is app builder check-source command
+type AppBuilderCheckSource struct {
+	*AppBuilder
+	Input    string
+	ExitCode bool
+}
+
+// AppBuilderCheckSourceCmder returns Cmder for app builder check-source
+func (app *AppBuilder) AppBuilderCheckSourceCmder() cmder.Cmder {
+	return &AppBuilderCheckSource{AppBuilder: app}
+}
+
+// Cmd returns Command for app builder check-source
+func (app *AppBuilderCheckSource) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "check-source",
+		Short:        "Check if source image or inputs changed since the last build",
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	cmd.Flags().StringVarP(&app.Input, "input", "i", defaultBuilderInput, "input file path")
+	cmd.Flags().BoolVarP(&app.ExitCode, "exit-code", "", false, "exit with status 1 if there are changes")
+	return cmd
+}
+
+// RunE is main routine for app builder check-source
+func (app *AppBuilderCheckSource) RunE(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	app.LogBuilderName()
+	changed, err := app.CheckChanges(ctx, app.Input)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		app.Log("No changes")
+		return nil
+	}
+	app.Log("Changes detected")
+	if app.ExitCode {
+		return &ExitError{Code: 1, Err: fmt.Errorf("source image or inputs changed")}
+	}
+	return nil
+}
+
+// CheckChanges reports whether the latest source image version or inputs differ from the last build
+func (app *AppBuilder) CheckChanges(ctx context.Context, input string) (bool, error) {
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return false, err
+	}
+
+	// Resolve source versions as they would be pinned now
+	pinSource := app.PinSource
+	app.PinSource = true
+	template, su, err := app.ResolveTemplate(ctx, input)
+	app.PinSource = pinSource
+	if err != nil {
+		return false, err
+	}
+
+	// The build manifest survives deletion of the image template (builder build --delete)
+	latest := builderSourceString(template.Source)
+	current := ""
+	manifest, err := app.ReadManifest(ctx)
+	if err == nil {
+		current = manifest.Source
+	} else {
+		app.Logf("Inputs: no build manifest: %s", err)
+		manifest = nil
+		templatesClient := virtualmachineimagebuilder.NewVirtualMachineImageTemplatesClient(app.Config.SubscriptionID)
+		templatesClient.Authorizer = authorizer
+		deployed, err := templatesClient.Get(ctx, app.Config.Builder.ResourceGroup, app.Config.Builder.BuilderName)
+		if err != nil {
+			if aErr := azutil.Error(err); aErr == nil || aErr.StatusCode != http.StatusNotFound {
+				return false, err
+			}
+			app.Log("Source: image template not found")
+			return true, nil
+		}
+		if tag, ok := deployed.Tags[TagSourceImage]; ok && tag != nil {
+			current = *tag
+		} else if deployed.ImageTemplateProperties != nil {
+			current = builderSourceString(deployed.Source)
+		}
+	}
+
+	if strings.HasSuffix(strings.ToLower(current), ":latest") {
+		app.Logf("Source: current version unknown: %s (use --pin-source to record it)", current)
+		return true, nil
+	}
+	app.Logf("Source: current %s", current)
+	app.Logf("Source: latest  %s", latest)
+	if !strings.EqualFold(current, latest) {
+		app.Log("Source: new version available")
+		return true, nil
+	}
+
+	if manifest == nil {
+		return true, nil
+	}
+	switch virtualmachineimagebuilder.RunState(manifest.RunState) {
+	case virtualmachineimagebuilder.RunStateSucceeded, virtualmachineimagebuilder.RunStatePartiallySucceeded:
+	default:
+		app.Logf("Inputs: last build not succeeded: %s", ssutil.FirstNonEmpty(manifest.RunState, "not run"))
+		return true, nil
+	}
+	return app.CheckManifestInputs(manifest, template, su.Uploads())
+}
+
+// CheckManifestInputs reports whether the resolved template or uploaded files differ from the build manifest
+func (app *App) CheckManifestInputs(manifest *BuildManifest, template *virtualmachineimagebuilder.ImageTemplate, uploads map[string]string) (bool, error) {
+	next, err := app.NewBuildManifest(template, uploads)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	prevUploads := map[string]string{}
+	for _, u := range manifest.Uploads {
+		prevUploads[u.Path] = u.SHA256
+	}
+	for _, u := range next.Uploads {
+		prev, ok := prevUploads[u.Path]
+		switch {
+		case !ok:
+			app.Logf("Inputs: added file %s", u.Path)
+			changed = true
+		case prev != u.SHA256:
+			app.Logf("Inputs: modified file %s", u.Path)
+			changed = true
+		}
+		delete(prevUploads, u.Path)
+	}
+	for p := range prevUploads {
+		app.Logf("Inputs: removed file %s", p)
+		changed = true
+	}
+
+	var a, b interface{}
+	err = json.Unmarshal(manifest.Template, &a)
+	if err != nil {
+		return false, err
+	}
+	err = json.Unmarshal(next.Template, &b)
+	if err != nil {
+		return false, err
+	}
+	jsondiff.Delete(a, "tags."+TagCreatedAt)
+	for _, c := range jsondiff.Diff(a, b) {
+		app.Logf("Inputs: template %s", c)
+		changed = true
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+// AppBuilderCopyVHD is app builder copy-vhd command
+type AppBuilderCopyVHD struct {
+	*AppBuilder
+}
+
+// AppBuilderCopyVHDCmder returns Cmder for app builder copy-vhd
+func (app *AppBuilder) AppBuilderCopyVHDCmder() cmder.Cmder {
+	return &AppBuilderCopyVHD{AppBuilder: app}
+}
+
+// Cmd returns Command for app builder copy-vhd
+func (app *AppBuilderCopyVHD) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "copy-vhd",
+		Short:        "Copy distributed VHD to storage container",
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	return cmd
+}
+
+// RunE is main routine for app builder copy-vhd
+func (app *AppBuilderCopyVHD) RunE(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	app.LogBuilderName()
+	app.Log("Getting VHD run output...")
+	artifactURI, err := app.VHDArtifactURI(ctx)
+	if err != nil {
+		return err
+	}
+	app.Logf("VHD: artifact %s", artifactURI)
+
+	blobURL, err := app.VHDCopy(ctx, artifactURI)
+	if err != nil {
+		return err
+	}
+	app.Logf("VHD: copied to %s", blobURL)
+
+	return nil
+}
@@ -2,12 +2,16 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/virtualmachineimagebuilder/mgmt/2020-02-14/virtualmachineimagebuilder"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/spf13/cobra"
 	cmder "github.com/yaegashi/cobra-cmder"
+	"muzzammil.xyz/jsonc"
 
 	"github.com/yaegashi/customazed/utils/inpututil"
 )
@@ -15,7 +19,9 @@ import (
 // AppBuilderCreate is app builder create command
 type AppBuilderCreate struct {
 	*AppBuilder
-	Input string
+	Input    string
+	All      bool
+	Parallel int
 }
 
 // AppBuilderCreateCmder returns Cmder for app builder create
@@ -31,40 +37,170 @@ func (app *AppBuilderCreate) Cmd() *cobra.Command {
 		RunE:         app.RunE,
 		SilenceUsage: true,
 	}
-	cmd.Flags().StringVarP(&app.Input, "input", "i", "customazed_builder.json", "input file path")
+	cmd.Flags().StringVarP(&app.Input, "input", "i", defaultBuilderInput, "input file path")
+	cmd.Flags().BoolVarP(&app.PinSource, "pin-source", "", false, "resolve latest platform image version of source")
+	cmd.Flags().BoolVarP(&app.ManifestTag, "manifest-tag", "", false, "add build manifest hash to artifact tags")
+	cmd.Flags().BoolVarP(&app.All, "all", "", false, "create image templates for all matrix cells")
+	ParallelFlag(cmd, &app.Parallel)
 	return cmd
 }
 
 // RunE is main routine for app builder create
 func (app *AppBuilderCreate) RunE(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
+	if app.All {
+		app.Prompt("Creating image templates for %d matrix cells", len(app.ConfigLoad.MatrixCells()))
+		return app.ForEachCell(ctx, app.Parallel, func(b *AppBuilder) error {
+			return b.CreateTemplate(ctx, app.Input)
+		})
+	}
+	return app.CreateTemplate(ctx, app.Input)
+}
+
+// PreparedTemplate is resolved image template confirmed for creation
+type PreparedTemplate struct {
+	Template     *virtualmachineimagebuilder.ImageTemplate
+	Uploader     StorageUploader
+	ManifestJSON []byte
+}
+
+// CreateTemplate creates image template from input file
+func (app *AppBuilder) CreateTemplate(ctx context.Context, input string) error {
+	prepared, err := app.PrepareTemplate(ctx, input)
+	if err != nil {
+		return err
+	}
+	return app.DeployTemplate(ctx, prepared)
+}
+
+// PrepareTemplate resolves image template from input file and asks for confirmation
+func (app *AppBuilder) PrepareTemplate(ctx context.Context, input string) (*PreparedTemplate, error) {
+	template, su, err := app.ResolveTemplate(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	template.Tags[TagCreatedAt] = to.StringPtr(time.Now().UTC().Format(time.RFC3339))
+
+	manifest, err := app.NewBuildManifest(template, su.Uploads())
+	if err != nil {
+		return nil, err
+	}
+	manifestJSON, manifestSHA256, err := MarshalManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if app.ManifestTag {
+		app.Logf("Manifest: SHA-256 %s", manifestSHA256)
+		for _, d := range *template.Distribute {
+			switch d := d.(type) {
+			case *virtualmachineimagebuilder.ImageTemplateManagedImageDistributor:
+				d.ArtifactTags = manifestArtifactTags(d.ArtifactTags, manifestSHA256)
+			case *virtualmachineimagebuilder.ImageTemplateSharedImageDistributor:
+				d.ArtifactTags = manifestArtifactTags(d.ArtifactTags, manifestSHA256)
+			case *virtualmachineimagebuilder.ImageTemplateVhdDistributor:
+				d.ArtifactTags = manifestArtifactTags(d.ArtifactTags, manifestSHA256)
+			}
+		}
+	}
+
+	app.Dump(template)
+	app.LogBuilderName()
+	app.Prompt("Files to upload: %d", su.Files())
+
+	return &PreparedTemplate{Template: template, Uploader: su, ManifestJSON: manifestJSON}, nil
+}
+
+// DeployTemplate uploads files and creates the prepared image template
+func (app *AppBuilder) DeployTemplate(ctx context.Context, prepared *PreparedTemplate) error {
 	authorizer, err := app.ARMAuthorizer()
 	if err != nil {
 		return err
 	}
 
-	identity, err := app.Identity(ctx)
+	su := prepared.Uploader
+	if su.Valid() && su.Files() > 0 {
+		err = su.Execute(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	app.Log("Creating image template...")
+	templatesClient := virtualmachineimagebuilder.NewVirtualMachineImageTemplatesClient(app.Config.SubscriptionID)
+	templatesClient.Authorizer = authorizer
+	templateFuture, err := templatesClient.CreateOrUpdate(ctx, *prepared.Template, app.Config.Builder.ResourceGroup, app.Config.Builder.BuilderName)
 	if err != nil {
 		return err
 	}
+	err = app.WaitForCompletion(ctx, &templateFuture, templatesClient.Client)
+	if err != nil {
+		return err
+	}
+
+	return app.WriteManifest(ctx, prepared.ManifestJSON)
+}
+
+func manifestArtifactTags(tags map[string]*string, sum string) map[string]*string {
+	if tags == nil {
+		tags = map[string]*string{}
+	}
+	tags[TagManifestSHA256] = to.StringPtr(sum)
+	return tags
+}
+
+// ResolveTemplate loads image template from input file and completes it with configuration.
+// Files referenced by the template are added to the returned uploader but not uploaded.
+func (app *AppBuilder) ResolveTemplate(ctx context.Context, input string) (*virtualmachineimagebuilder.ImageTemplate, StorageUploader, error) {
+	identity, err := app.Identity(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	image, err := app.Image(ctx)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	galleryImage, err := app.GalleryImage(ctx)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	subnet, err := app.Subnet(ctx)
+	if err != nil {
+		return nil, nil, err
 	}
 
+	b, err := inpututil.ReadJSONC(input)
+	if err != nil {
+		return nil, nil, err
+	}
 	var template virtualmachineimagebuilder.ImageTemplate
-	err = inpututil.UnmarshalJSONC(app.Input, &template)
+	err = jsonc.Unmarshal(b, &template)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	// Reject properties which the SDK would silently drop
+	var raw struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	err = jsonc.Unmarshal(b, &raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, k := range []string{"validate", "optimize"} {
+		if _, ok := raw.Properties[k]; ok {
+			return nil, nil, fmt.Errorf("%s: properties.%s is not supported by image builder API %s", input, k, builderAPIVersion)
+		}
 	}
 
 	template.Location = &app.Config.Builder.Location
+	if template.Tags == nil {
+		template.Tags = map[string]*string{}
+	}
+	for k, v := range app.Tags(app.Config.Builder.Tags) {
+		template.Tags[k] = v
+	}
 
 	if identity != nil {
 		template.Identity = &virtualmachineimagebuilder.ImageTemplateIdentity{
@@ -75,6 +211,23 @@ func (app *AppBuilderCreate) RunE(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// Overrides from configuration
+	if template.VMProfile == nil {
+		template.VMProfile = &virtualmachineimagebuilder.ImageTemplateVMProfile{}
+	}
+	if app.Config.Builder.VMSize != "" {
+		template.VMProfile.VMSize = to.StringPtr(app.Config.Builder.VMSize)
+	}
+	if app.Config.Builder.OSDiskSizeGB > 0 {
+		template.VMProfile.OsDiskSizeGB = to.Int32Ptr(app.Config.Builder.OSDiskSizeGB)
+	}
+	if app.Config.Builder.BuildTimeoutInMinutes > 0 {
+		template.BuildTimeoutInMinutes = to.Int32Ptr(app.Config.Builder.BuildTimeoutInMinutes)
+	}
+	if subnet != nil {
+		template.VMProfile.VnetConfig = &virtualmachineimagebuilder.VirtualNetworkConfig{SubnetID: subnet.ID}
+	}
+
 	var distributes []virtualmachineimagebuilder.BasicImageTemplateDistributor
 	if template.Distribute != nil {
 		distributes = *template.Distribute
@@ -85,72 +238,90 @@ func (app *AppBuilderCreate) RunE(cmd *cobra.Command, args []string) error {
 			Location:      &app.Config.Image.Location,
 			ImageID:       &app.Config.Image.ImageID,
 			RunOutputName: to.StringPtr("ManagedImage"),
+			ArtifactTags:  app.Tags(app.Config.Image.Tags),
 		})
 	}
 	if galleryImage != nil && !app.Config.Gallery.SkipCreate {
 		distributes = append(distributes, virtualmachineimagebuilder.ImageTemplateSharedImageDistributor{
 			GalleryImageID:     galleryImage.ID,
-			ReplicationRegions: &app.Config.Gallery.ReplicationRegions,
+			ReplicationRegions: to.StringSlicePtr(app.GalleryReplicationRegionNames()),
 			ExcludeFromLatest:  &app.Config.Gallery.ExcludeFromLatest,
 			StorageAccountType: virtualmachineimagebuilder.SharedImageStorageAccountType(app.Config.Gallery.StorageAccountType),
 			RunOutputName:      to.StringPtr("SharedImage"),
+			ArtifactTags:       app.Tags(app.Config.Gallery.Tags),
+		})
+	}
+	if app.Config.VHD.Enabled {
+		distributes = append(distributes, virtualmachineimagebuilder.ImageTemplateVhdDistributor{
+			Type:          virtualmachineimagebuilder.TypeBasicImageTemplateDistributorTypeVHD,
+			RunOutputName: to.StringPtr(VHDRunOutputName),
+			ArtifactTags:  app.Tags(app.Config.VHD.Tags),
 		})
 	}
 	if len(distributes) == 0 {
-		return fmt.Errorf("no distribution to create")
+		return nil, nil, fmt.Errorf("no distribution to create")
 	}
-	template.Distribute = &distributes
 
-	// Workaround for validation failure
+	// Convert polymorphic values decoded by the SDK into their concrete pointer types
+	// so that validation and template variable resolution work for every type.
 	// Similar issue: https://github.com/Azure/azure-sdk-for-go/issues/2445
-	if s, ok := template.Source.AsImageTemplateManagedImageSource(); ok {
-		template.Source = s
-	} else if s, ok := template.Source.AsImageTemplatePlatformImageSource(); ok {
-		template.Source = s
-	} else if s, ok := template.Source.AsImageTemplateSharedImageVersionSource(); ok {
-		template.Source = s
-	}
-
-	// Workaround for validation failure
-	var customizes []virtualmachineimagebuilder.BasicImageTemplateCustomizer
-	for _, customize := range *template.Customize {
-		if c, ok := customize.AsImageTemplateShellCustomizer(); ok {
-			customizes = append(customizes, c)
-		} else if c, ok := customize.AsImageTemplatePowerShellCustomizer(); ok {
-			customizes = append(customizes, c)
-		} else if c, ok := customize.AsImageTemplateFileCustomizer(); ok {
-			customizes = append(customizes, c)
-		} else {
-			customizes = append(customizes, customize)
+	for i, d := range distributes {
+		distributes[i], err = BuilderDistributor(d)
+		if err != nil {
+			return nil, nil, err
 		}
 	}
-	template.Customize = &customizes
+	template.Distribute = &distributes
+
+	template.Source, err = BuilderSource(template.Source)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if template.Customize != nil {
+		customizes := *template.Customize
+		for i, c := range customizes {
+			customizes[i], err = BuilderCustomizer(c)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	var inlineFileEntries []map[int]bool
+	if template.Customize != nil {
+		inlineFileEntries = BuilderInlineFileEntries(*template.Customize)
+	}
 
 	su := app.NewStorageUploader(ctx)
 	tv := app.NewTemplateVariable(su)
 	err = tv.Resolve(&template)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	if template.Customize != nil {
+		err = BuilderInlineLines(*template.Customize, inlineFileEntries)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	app.Dump(template)
-	app.LogBuilderName()
-	app.Prompt("Files to upload: %d", su.Files())
-
-	if su.Valid() && su.Files() > 0 {
-		err = su.Execute(ctx)
+	if s, ok := template.Source.(*virtualmachineimagebuilder.ImageTemplateSharedImageVersionSource); ok && strings.HasPrefix(to.String(s.ImageVersionID), GallerySourcePrefix) {
+		version, err := app.GallerySourceVersion(ctx, *s.ImageVersionID)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
+		app.Logf("Builder: resolved source %s to %s", *s.ImageVersionID, *version.ID)
+		s.ImageVersionID = version.ID
+		template.Tags[TagSourceImage] = version.ID
 	}
 
-	app.Log("Creating image template...")
-	templatesClient := virtualmachineimagebuilder.NewVirtualMachineImageTemplatesClient(app.Config.SubscriptionID)
-	templatesClient.Authorizer = authorizer
-	templateFuture, err := templatesClient.CreateOrUpdate(ctx, template, app.Config.Builder.ResourceGroup, app.Config.Builder.BuilderName)
-	if err != nil {
-		return err
+	if app.PinSource {
+		err = app.BuilderPinSource(ctx, &template)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	return app.WaitForCompletion(ctx, &templateFuture, templatesClient.Client)
+	return &template, su, nil
 }
@@ -32,12 +32,17 @@ func (app *AppBuilderDelete) Cmd() *cobra.Command {
 // RunE is main routine for app builder delete
 func (app *AppBuilderDelete) RunE(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
+	app.LogBuilderName()
+	return app.DeleteTemplate(ctx)
+}
+
+// DeleteTemplate deletes image template
+func (app *AppBuilder) DeleteTemplate(ctx context.Context) error {
 	authorizer, err := app.ARMAuthorizer()
 	if err != nil {
 		return err
 	}
 
-	app.LogBuilderName()
 	app.Log("Deleting image template...")
 	templatesClient := virtualmachineimagebuilder.NewVirtualMachineImageTemplatesClient(app.Config.SubscriptionID)
 	templatesClient.Authorizer = authorizer
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/virtualmachineimagebuilder/mgmt/2020-02-14/virtualmachineimagebuilder"
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+
+	"github.com/yaegashi/customazed/utils/azutil"
+	"github.com/yaegashi/customazed/utils/jsondiff"
+)
+
+// Fields populated by the server which are ignored in app builder diff
+var builderDiffIgnoredPaths = []string{
+	"id",
+	"name",
+	"type",
+	"systemData",
+	"tags." + TagCreatedAt,
+	"tags." + TagSourceImage,
+	"properties.distribute.*.artifactTags." + TagManifestSHA256,
+	"identity.principalId",
+	"identity.tenantId",
+	"identity.userAssignedIdentities.*.principalId",
+	"identity.userAssignedIdentities.*.clientId",
+	"properties.provisioningState",
+	"properties.provisioningError",
+	"properties.lastRunStatus",
+}
+
+// AppBuilderDiff is app builder diff command
+type AppBuilderDiff struct {
+	*AppBuilder
+	Input    string
+	ExitCode bool
+}
+
+// AppBuilderDiffCmder returns Cmder for app builder diff
+func (app *AppBuilder) AppBuilderDiffCmder() cmder.Cmder {
+	return &AppBuilderDiff{AppBuilder: app}
+}
+
+// Cmd returns Command for app builder diff
+func (app *AppBuilderDiff) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "diff",
+		Short:        "Show differences between input file and deployed image template",
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	cmd.Flags().StringVarP(&app.Input, "input", "i", defaultBuilderInput, "input file path")
+	cmd.Flags().BoolVarP(&app.PinSource, "pin-source", "", false, "resolve latest platform image version of source (implied if the image template was created with it)")
+	cmd.Flags().BoolVarP(&app.ExitCode, "exit-code", "", false, "exit with status 1 if there are differences")
+	return cmd
+}
+
+// RunE is main routine for app builder diff
+func (app *AppBuilderDiff) RunE(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	app.LogBuilderName()
+	app.Log("Getting image template...")
+	templatesClient := virtualmachineimagebuilder.NewVirtualMachineImageTemplatesClient(app.Config.SubscriptionID)
+	templatesClient.Authorizer = authorizer
+	deployed, err := templatesClient.Get(ctx, app.Config.Builder.ResourceGroup, app.Config.Builder.BuilderName)
+	if err != nil {
+		if aErr := azutil.Error(err); aErr == nil || aErr.StatusCode != http.StatusNotFound {
+			return err
+		}
+		app.Log("Image template not found")
+	}
+
+	// Compare with the source pinned the same way as the deployed image template
+	if _, ok := deployed.Tags[TagSourceImage]; ok && !app.PinSource {
+		app.Log("Source: image template was created with pinned source")
+		app.PinSource = true
+	}
+	template, _, err := app.ResolveTemplate(ctx, app.Input)
+	if err != nil {
+		return err
+	}
+
+	var a, b interface{} = map[string]interface{}{}, nil
+	if deployed.ImageTemplateProperties != nil {
+		a, err = builderDiffNormalize(deployed)
+		if err != nil {
+			return err
+		}
+	}
+	b, err = builderDiffNormalize(*template)
+	if err != nil {
+		return err
+	}
+
+	var changes []jsondiff.Change
+	for _, c := range jsondiff.Diff(a, b) {
+		// Skip defaults filled by the server
+		if c.Kind == jsondiff.Removed && jsondiff.IsEmpty(c.Old) || c.Kind == jsondiff.Added && jsondiff.IsEmpty(c.New) {
+			continue
+		}
+		changes = append(changes, c)
+	}
+
+	if len(changes) == 0 {
+		app.Log("No differences")
+		return nil
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	app.Logf("Differences: %d", len(changes))
+	if app.ExitCode {
+		return &ExitError{Code: 1, Err: fmt.Errorf("image template differs from input")}
+	}
+
+	return nil
+}
+
+func builderDiffNormalize(template virtualmachineimagebuilder.ImageTemplate) (interface{}, error) {
+	v, err := jsondiff.Normalize(template)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range builderDiffIgnoredPaths {
+		jsondiff.Delete(v, p)
+	}
+	// Locations are returned as names ("eastus") while they may be given as display names ("East US")
+	if m, ok := v.(map[string]interface{}); ok {
+		if l, ok := m["location"].(string); ok {
+			m["location"] = strings.ToLower(strings.ReplaceAll(l, " ", ""))
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+// AppBuilderFetchLogs is app builder fetch-logs command
+type AppBuilderFetchLogs struct {
+	*AppBuilder
+	Dir  string
+	Gzip bool
+}
+
+// AppBuilderFetchLogsCmder returns Cmder for app builder fetch-logs
+func (app *AppBuilder) AppBuilderFetchLogsCmder() cmder.Cmder {
+	return &AppBuilderFetchLogs{AppBuilder: app}
+}
+
+// Cmd returns Command for app builder fetch-logs
+func (app *AppBuilderFetchLogs) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "fetch-logs",
+		Short:        "Download all image build logs to local directory",
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	cmd.Flags().StringVarP(&app.Dir, "dir", "d", ".", "output directory")
+	cmd.Flags().BoolVarP(&app.Gzip, "gzip", "z", false, "compress log files with gzip")
+	return cmd
+}
+
+// RunE is main routine for app builder fetch-logs
+func (app *AppBuilderFetchLogs) RunE(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	app.LogBuilderName()
+
+	containerURL, err := app.BuilderLogContainer(ctx)
+	if err != nil {
+		return err
+	}
+
+	blobItems, err := app.BuilderLogBlobs(ctx, containerURL)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(app.Dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range blobItems {
+		name := strings.ReplaceAll(item.Name, "/", "_")
+		if item.Properties.CreationTime != nil {
+			name = item.Properties.CreationTime.UTC().Format("20060102T150405Z") + "_" + name
+		}
+		if app.Gzip {
+			name += ".gz"
+		}
+		path := filepath.Join(app.Dir, name)
+		app.Logf("Downloading %s to %s", item.Name, path)
+		err := app.fetchLog(ctx, containerURL.NewAppendBlobURL(item.Name), path)
+		if err != nil {
+			return err
+		}
+	}
+
+	app.Logf("Downloaded %d log blobs", len(blobItems))
+
+	return nil
+}
+
+func (app *AppBuilderFetchLogs) fetchLog(ctx context.Context, blobURL azblob.AppendBlobURL, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if !app.Gzip {
+		_, err = app.BuilderDownloadLog(ctx, blobURL, 0, f)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+
+	zw := gzip.NewWriter(f)
+	_, err = app.BuilderDownloadLog(ctx, blobURL, 0, zw)
+	if err != nil {
+		return err
+	}
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
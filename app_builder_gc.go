@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/profiles/2020-09-01/resources/mgmt/resources"
+	"github.com/Azure/azure-sdk-for-go/services/virtualmachineimagebuilder/mgmt/2020-02-14/virtualmachineimagebuilder"
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+
+	"github.com/yaegashi/customazed/utils/azutil"
+)
+
+// AppBuilderGC is app builder gc command
+type AppBuilderGC struct {
+	*AppBuilder
+	DryRun bool
+	MinAge time.Duration
+}
+
+// AppBuilderGCCmder returns Cmder for app builder gc
+func (app *AppBuilder) AppBuilderGCCmder() cmder.Cmder {
+	return &AppBuilderGC{AppBuilder: app}
+}
+
+// Cmd returns Command for app builder gc
+func (app *AppBuilderGC) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "gc",
+		Short:        "Delete orphaned image builder staging resource groups",
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	cmd.Flags().BoolVarP(&app.DryRun, "dry-run", "n", false, "show orphaned resource groups without deleting them")
+	cmd.Flags().DurationVarP(&app.MinAge, "min-age", "", 24*time.Hour, "delete only resource groups older than this")
+	return cmd
+}
+
+// RunE is main routine for app builder gc
+func (app *AppBuilderGC) RunE(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	app.Log("Finding orphaned image builder staging resource groups...")
+	groups, err := app.BuilderStagingGroups(ctx)
+	if err != nil {
+		return err
+	}
+
+	templatesClient := virtualmachineimagebuilder.NewVirtualMachineImageTemplatesClient(app.Config.SubscriptionID)
+	templatesClient.Authorizer = authorizer
+	var orphans []resources.Group
+	for _, group := range groups {
+		name, resourceGroupName, _ := BuilderStagingTemplate(group)
+		_, err := templatesClient.Get(ctx, resourceGroupName, name)
+		if err == nil {
+			continue
+		}
+		if aErr := azutil.Error(err); aErr == nil || aErr.StatusCode != http.StatusNotFound {
+			return err
+		}
+
+		groupResources, err := app.BuilderStagingResources(ctx, &group)
+		if err != nil {
+			return err
+		}
+		var created time.Time
+		for _, r := range groupResources {
+			if r.CreatedTime != nil && (created.IsZero() || r.CreatedTime.Before(created)) {
+				created = r.CreatedTime.Time
+			}
+		}
+		age := "unknown"
+		if !created.IsZero() {
+			age = time.Since(created).Round(time.Minute).String()
+		}
+		// Resource groups have no creation time, so the oldest resource in it is used instead.
+		// Younger groups may belong to an image template being created or deleted right now.
+		if app.MinAge > 0 && (created.IsZero() || time.Since(created) < app.MinAge) {
+			app.Logf("Skipping: %s (image template %s/%s, age %s, younger than %s)", *group.Name, resourceGroupName, name, age, app.MinAge)
+			continue
+		}
+		app.Logf("Orphaned: %s (image template %s/%s, age %s, %d resources)", *group.Name, resourceGroupName, name, age, len(groupResources))
+		for _, r := range groupResources {
+			app.Logf("  %s", *r.ID)
+		}
+		orphans = append(orphans, group)
+	}
+
+	if len(orphans) == 0 {
+		app.Log("No orphaned resource groups found")
+		return nil
+	}
+	if app.DryRun {
+		app.Logf("Resource groups to delete: %d (dry run)", len(orphans))
+		return nil
+	}
+	app.Prompt("Resource groups to delete: %d", len(orphans))
+
+	groupsClient := resources.NewGroupsClient(app.Config.SubscriptionID)
+	groupsClient.Authorizer = authorizer
+	for _, group := range orphans {
+		app.Logf("Deleting resource group %s...", *group.Name)
+		groupFuture, err := groupsClient.Delete(ctx, *group.Name)
+		if err != nil {
+			return err
+		}
+		err = app.WaitForCompletion(ctx, &groupFuture, groupsClient.Client)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/virtualmachineimagebuilder/mgmt/2020-02-14/virtualmachineimagebuilder"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+// AppBuilderList is app builder list command
+type AppBuilderList struct {
+	*AppBuilder
+	All    bool
+	Output string
+}
+
+// AppBuilderListCmder returns Cmder for app builder list
+func (app *AppBuilder) AppBuilderListCmder() cmder.Cmder {
+	return &AppBuilderList{AppBuilder: app}
+}
+
+// Cmd returns Command for app builder list
+func (app *AppBuilderList) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List image templates",
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	cmd.Flags().BoolVarP(&app.All, "all", "", false, "list image templates in all resource groups of the subscription")
+	cmd.Flags().StringVarP(&app.Output, "output", "o", "table", "output format (table or json)")
+	return cmd
+}
+
+// builderListItem is an image template summary shown by app builder list
+type builderListItem struct {
+	Name              string   `json:"name"`
+	ResourceGroup     string   `json:"resourceGroup"`
+	Location          string   `json:"location"`
+	ProvisioningState string   `json:"provisioningState"`
+	RunState          string   `json:"runState,omitempty"`
+	RunSubState       string   `json:"runSubState,omitempty"`
+	StartTime         string   `json:"startTime,omitempty"`
+	EndTime           string   `json:"endTime,omitempty"`
+	Duration          string   `json:"duration,omitempty"`
+	Source            string   `json:"source"`
+	Distribute        []string `json:"distribute"`
+}
+
+// RunE is main routine for app builder list
+func (app *AppBuilderList) RunE(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	if app.Output != "table" && app.Output != "json" {
+		return fmt.Errorf("unknown output format %q", app.Output)
+	}
+
+	templatesClient := virtualmachineimagebuilder.NewVirtualMachineImageTemplatesClient(app.Config.SubscriptionID)
+	templatesClient.Authorizer = authorizer
+	var result virtualmachineimagebuilder.ImageTemplateListResultIterator
+	if app.All {
+		app.Logf("Listing image templates in subscription %s...", app.Config.SubscriptionID)
+		result, err = templatesClient.ListComplete(ctx)
+	} else {
+		app.Logf("Listing image templates in %s...", app.Config.Builder.ResourceGroup)
+		result, err = templatesClient.ListByResourceGroupComplete(ctx, app.Config.Builder.ResourceGroup)
+	}
+	if err != nil {
+		return err
+	}
+
+	items := []*builderListItem{}
+	for result.NotDone() {
+		items = append(items, newBuilderListItem(result.Value()))
+		err := result.NextWithContext(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if app.Output == "json" {
+		b, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tRESOURCE GROUP\tPROVISIONING\tLAST RUN\tDURATION\tSOURCE\tDISTRIBUTE")
+	for _, item := range items {
+		runState := item.RunState
+		if item.RunSubState != "" {
+			runState += "/" + item.RunSubState
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			item.Name, item.ResourceGroup, item.ProvisioningState,
+			dashIfEmpty(runState), dashIfEmpty(item.Duration), item.Source, dashIfEmpty(strings.Join(item.Distribute, ",")))
+	}
+	w.Flush()
+
+	return nil
+}
+
+func newBuilderListItem(t virtualmachineimagebuilder.ImageTemplate) *builderListItem {
+	item := &builderListItem{Distribute: []string{}}
+	if t.Name != nil {
+		item.Name = *t.Name
+	}
+	if t.Location != nil {
+		item.Location = *t.Location
+	}
+	if t.ID != nil {
+		if r, err := azure.ParseResourceID(*t.ID); err == nil {
+			item.ResourceGroup = r.ResourceGroup
+		}
+	}
+	p := t.ImageTemplateProperties
+	if p == nil {
+		return item
+	}
+	item.ProvisioningState = string(p.ProvisioningState)
+	if s := p.LastRunStatus; s != nil {
+		item.RunState = string(s.RunState)
+		item.RunSubState = string(s.RunSubState)
+		if s.StartTime != nil {
+			item.StartTime = s.StartTime.Format(time.RFC3339)
+			end := time.Now()
+			if s.EndTime != nil && !s.EndTime.Before(s.StartTime.Time) {
+				item.EndTime = s.EndTime.Format(time.RFC3339)
+				end = s.EndTime.Time
+			}
+			item.Duration = end.Sub(s.StartTime.Time).Round(time.Second).String()
+		}
+	}
+	item.Source = builderSourceString(p.Source)
+	if p.Distribute != nil {
+		for _, d := range *p.Distribute {
+			item.Distribute = append(item.Distribute, builderDistributorString(d))
+		}
+	}
+	return item
+}
+
+func builderSourceString(source virtualmachineimagebuilder.BasicImageTemplateSource) string {
+	if source == nil {
+		return "-"
+	}
+	if s, ok := source.AsImageTemplatePlatformImageSource(); ok {
+		return fmt.Sprintf("%s:%s:%s:%s", to.String(s.Publisher), to.String(s.Offer), to.String(s.Sku), to.String(s.Version))
+	}
+	if s, ok := source.AsImageTemplateManagedImageSource(); ok {
+		return to.String(s.ImageID)
+	}
+	if s, ok := source.AsImageTemplateSharedImageVersionSource(); ok {
+		return to.String(s.ImageVersionID)
+	}
+	return "-"
+}
+
+func builderDistributorString(distributor virtualmachineimagebuilder.BasicImageTemplateDistributor) string {
+	if d, ok := distributor.AsImageTemplateManagedImageDistributor(); ok {
+		return "ManagedImage:" + to.String(d.ImageID)
+	}
+	if d, ok := distributor.AsImageTemplateSharedImageDistributor(); ok {
+		return "SharedImage:" + to.String(d.GalleryImageID)
+	}
+	if d, ok := distributor.AsImageTemplateVhdDistributor(); ok {
+		return "VHD:" + to.String(d.RunOutputName)
+	}
+	return "-"
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/virtualmachineimagebuilder/mgmt/2020-02-14/virtualmachineimagebuilder"
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+// AppBuilderPrune is app builder prune command
+type AppBuilderPrune struct {
+	*AppBuilder
+	Keep        int
+	YoungerThan time.Duration
+	DryRun      bool
+}
+
+// AppBuilderPruneCmder returns Cmder for app builder prune
+func (app *AppBuilder) AppBuilderPruneCmder() cmder.Cmder {
+	return &AppBuilderPrune{AppBuilder: app}
+}
+
+// Cmd returns Command for app builder prune
+func (app *AppBuilderPrune) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "prune",
+		Short:        "Delete stale image templates created by customazed",
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	cmd.Flags().IntVarP(&app.Keep, "keep", "", -1, "keep N most recent image templates")
+	cmd.Flags().DurationVarP(&app.YoungerThan, "younger-than", "", 0, "keep image templates younger than duration")
+	cmd.Flags().BoolVarP(&app.DryRun, "dry-run", "n", false, "show image templates to delete without deleting them")
+	return cmd
+}
+
+// RunE is main routine for app builder prune
+func (app *AppBuilderPrune) RunE(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	if app.Keep < 0 && app.YoungerThan == 0 {
+		return fmt.Errorf("specify --keep or --younger-than")
+	}
+
+	app.LogBuilderName()
+	app.Logf("Listing image templates in %s...", app.Config.Builder.ResourceGroup)
+	templatesClient := virtualmachineimagebuilder.NewVirtualMachineImageTemplatesClient(app.Config.SubscriptionID)
+	templatesClient.Authorizer = authorizer
+	result, err := templatesClient.ListByResourceGroupComplete(ctx, app.Config.Builder.ResourceGroup)
+	if err != nil {
+		return err
+	}
+
+	type candidate struct {
+		name    string
+		created time.Time
+	}
+	var candidates []candidate
+	for result.NotDone() {
+		t := result.Value()
+		if createdBy, ok := t.Tags[TagCreatedBy]; ok && createdBy != nil && *createdBy == TagCreatedByValue {
+			c := candidate{name: *t.Name}
+			if createdAt, ok := t.Tags[TagCreatedAt]; ok && createdAt != nil {
+				c.created, _ = time.Parse(time.RFC3339, *createdAt)
+			}
+			candidates = append(candidates, c)
+		}
+		err := result.NextWithContext(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Sort by creation time (newest first)
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].created.After(candidates[j].created) })
+
+	var names []string
+	for i, c := range candidates {
+		keep := ""
+		switch {
+		case strings.EqualFold(c.name, app.Config.Builder.BuilderName):
+			keep = "current"
+		case app.Keep >= 0 && i < app.Keep:
+			keep = "recent"
+		case app.YoungerThan > 0 && !c.created.IsZero() && time.Since(c.created) < app.YoungerThan:
+			keep = "young"
+		}
+		created := "unknown"
+		if !c.created.IsZero() {
+			created = c.created.Format(time.RFC3339)
+		}
+		if keep != "" {
+			app.Logf("  keep   %s %s (%s)", created, c.name, keep)
+		} else {
+			app.Logf("  delete %s %s", created, c.name)
+			names = append(names, c.name)
+		}
+	}
+
+	if len(names) == 0 {
+		app.Log("No image templates to delete")
+		return nil
+	}
+	if app.DryRun {
+		app.Logf("Image templates to delete: %d (dry run)", len(names))
+		return nil
+	}
+	app.Prompt("Image templates to delete: %d", len(names))
+
+	for _, name := range names {
+		app.Logf("Deleting image template %s...", name)
+		templateFuture, err := templatesClient.Delete(ctx, app.Config.Builder.ResourceGroup, name)
+		if err != nil {
+			return err
+		}
+		err = app.WaitForCompletion(ctx, &templateFuture, templatesClient.Client)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -11,6 +11,8 @@ import (
 // AppBuilderRun is app builder run command
 type AppBuilderRun struct {
 	*AppBuilder
+	All      bool
+	Parallel int
 }
 
 // AppBuilderRunCmder returns Cmder for app builder run
@@ -26,12 +28,24 @@ func (app *AppBuilderRun) Cmd() *cobra.Command {
 		RunE:         app.RunE,
 		SilenceUsage: true,
 	}
+	cmd.Flags().BoolVarP(&app.All, "all", "", false, "run image builds for all matrix cells")
+	ParallelFlag(cmd, &app.Parallel)
 	return cmd
 }
 
 // RunE is main routine for app builder run
 func (app *AppBuilderRun) RunE(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
+	if app.All {
+		return app.ForEachCell(ctx, app.Parallel, func(b *AppBuilder) error {
+			return b.RunTemplate(ctx)
+		})
+	}
+	return app.RunTemplate(ctx)
+}
+
+// RunTemplate starts image build
+func (app *AppBuilder) RunTemplate(ctx context.Context) error {
 	authorizer, err := app.ARMAuthorizer()
 	if err != nil {
 		return err
@@ -47,6 +61,10 @@ func (app *AppBuilderRun) RunE(cmd *cobra.Command, args []string) error {
 	}
 
 	app.Logf("Image build started")
+	err = app.UpdateManifestRun(ctx)
+	if err != nil {
+		app.Logf("Warning: manifest: %s", err)
+	}
 	app.Logf("To show the image build status:    customazed builder show-status")
 	app.Logf("To watch customization.log output: customazed builder show-logs -F")
 
@@ -1,29 +1,29 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
 	"os"
-	"sort"
-	"strings"
+	"text/tabwriter"
 	"time"
 
-	"github.com/Azure/azure-sdk-for-go/profiles/2020-09-01/resources/mgmt/resources"
-	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2021-04-01/storage"
+	"github.com/Azure/azure-sdk-for-go/services/virtualmachineimagebuilder/mgmt/2020-02-14/virtualmachineimagebuilder"
 	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/spf13/cobra"
 	cmder "github.com/yaegashi/cobra-cmder"
+
+	"github.com/yaegashi/customazed/utils/packerlog"
 )
 
 // AppBuilderShowLogs is app builder show command
 type AppBuilderShowLogs struct {
 	*AppBuilder
-	LogName string
-	Tail    int64
-	Follow  bool
+	LogName    string
+	Tail       int64
+	Follow     bool
+	Summary    bool
+	Customizer string
 }
 
 // AppBuilderShowLogsCmder returns Cmder for app builder show
@@ -42,118 +42,30 @@ func (app *AppBuilderShowLogs) Cmd() *cobra.Command {
 	cmd.PersistentFlags().StringVarP(&app.LogName, "log", "", "", "name of the log to show (default the latest log)")
 	cmd.PersistentFlags().Int64VarP(&app.Tail, "tail", "", 1024, "last bytes of the log to show (0 means all)")
 	cmd.PersistentFlags().BoolVarP(&app.Follow, "follow", "F", false, "follow log output")
+	cmd.PersistentFlags().BoolVarP(&app.Summary, "summary", "", false, "show summary of build phases and errors")
+	cmd.PersistentFlags().StringVarP(&app.Customizer, "customizer", "", "", "show log lines of the customizer with name or type")
 	return cmd
 }
 
 // RunE is main routine for app builder show
 func (app *AppBuilderShowLogs) RunE(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
-	authorizer, err := app.ARMAuthorizer()
-	if err != nil {
-		return err
-	}
 
 	app.LogBuilderName()
 
-	// Find the resource group with specified tags
-	groupsClinet := resources.NewGroupsClient(app.Config.SubscriptionID)
-	groupsClinet.Authorizer = authorizer
-	groups, err := groupsClinet.ListComplete(ctx, "tagName eq 'createdBy' and tagValue eq 'AzureVMImageBuilder'", nil)
-	if err != nil {
-		return err
-	}
-	var group *resources.Group
-	for groups.NotDone() {
-		g := groups.Value()
-		if name, ok := g.Tags["imageTemplateName"]; ok {
-			if resourceGroupName := g.Tags["imageTemplateResourceGroupName"]; ok {
-				if strings.EqualFold(*name, app.Config.Builder.BuilderName) && strings.EqualFold(*resourceGroupName, app.Config.Builder.ResourceGroup) {
-					group = &g
-					break
-				}
-			}
-		}
-		err := groups.NextWithContext(ctx)
-		if err != nil {
-			return err
-		}
-	}
-	if group == nil {
-		return fmt.Errorf("builder resource group not found")
-	}
-	app.Logf("Builder resource group: %s", *group.Name)
-
-	// Find the storage account with specified tags
-	accountsClient := storage.NewAccountsClient(app.Config.SubscriptionID)
-	accountsClient.Authorizer = authorizer
-	accounts, err := accountsClient.ListByResourceGroupComplete(ctx, *group.Name)
-	if err != nil {
-		return err
-	}
-	var account *storage.Account
-	for accounts.NotDone() {
-		a := accounts.Value()
-		if createdby, ok := a.Tags["createdby"]; ok {
-			if *createdby == "azureimagebuilder" {
-				account = &a
-				break
-			}
-		}
-		err := accounts.NextWithContext(ctx)
-		if err != nil {
-			return err
-		}
-	}
-	if account == nil {
-		return fmt.Errorf("builder storage account not found")
-	}
-	app.Logf("Builder storage account: %s", *account.Name)
-
-	// Get shared access keys
-	keyResult, err := accountsClient.ListKeys(ctx, *group.Name, *account.Name, "")
+	containerURL, err := app.BuilderLogContainer(ctx)
 	if err != nil {
 		return err
 	}
-	accountKeys := *keyResult.Keys
 
-	// Find packerlogs container URL
-	credential, err := azblob.NewSharedKeyCredential(*account.Name, *accountKeys[0].Value)
+	blobItems, err := app.BuilderLogBlobs(ctx, containerURL)
 	if err != nil {
 		return err
 	}
-	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{})
-	endpointURL, _ := url.Parse(*account.PrimaryEndpoints.Blob)
-	serviceURL := azblob.NewServiceURL(*endpointURL, pipeline)
-	containerURL := serviceURL.NewContainerURL("packerlogs")
-
-	// Enumerate log blobs in packerlogs container
-	var blobItems []*azblob.BlobItemInternal
-	for marker := (azblob.Marker{}); marker.NotDone(); {
-		blobRes, err := containerURL.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{})
-		if err != nil {
-			return err
-		}
-		for i := range blobRes.Segment.BlobItems {
-			blobItems = append(blobItems, &blobRes.Segment.BlobItems[i])
-		}
-		marker = blobRes.NextMarker
-	}
 	if len(blobItems) == 0 {
 		return fmt.Errorf("no log blob found in packerlogs container")
 	}
 
-	// Sort log blobs by creation time
-	sort.Slice(blobItems, func(i, j int) bool {
-		var a, b time.Time
-		if blobItems[i].Properties.CreationTime != nil {
-			a = *blobItems[i].Properties.CreationTime
-		}
-		if blobItems[j].Properties.CreationTime != nil {
-			b = *blobItems[j].Properties.CreationTime
-		}
-		return a.Before(b)
-	})
-
 	// Select log blob to show
 	var blobItem *azblob.BlobItemInternal
 	name := app.LogName
@@ -170,6 +82,11 @@ func (app *AppBuilderShowLogs) RunE(cmd *cobra.Command, args []string) error {
 		app.Logf("  %s %s%s", item.Properties.CreationTime.Format(time.RFC3339), item.Name, selected)
 	}
 
+	blobURL := containerURL.NewAppendBlobURL(blobItem.Name)
+	if app.Summary || app.Customizer != "" {
+		return app.ShowParsedLog(ctx, blobURL)
+	}
+
 	// Calc offset
 	var offset int64
 	tail := app.Tail
@@ -184,25 +101,14 @@ func (app *AppBuilderShowLogs) RunE(cmd *cobra.Command, args []string) error {
 	}
 
 	// Download log blob and dump it to stdout
-	blobURL := containerURL.NewAppendBlobURL(blobItem.Name)
 	app.Logf("Getting %s", blobURL)
 	if offset > 0 {
 		os.Stdout.WriteString("....")
 	}
 	for {
-		res, err := blobURL.Download(ctx, offset, azblob.CountToEnd, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
-		if err == nil {
-			n, err := io.Copy(os.Stdout, res.Body(azblob.RetryReaderOptions{}))
-			res.Response().Body.Close()
-			if err != nil {
-				return err
-			}
-			offset += n
-		} else {
-			storageErr, ok := err.(azblob.StorageError)
-			if !ok || storageErr.Response().StatusCode != http.StatusRequestedRangeNotSatisfiable {
-				return err
-			}
+		offset, err = app.BuilderDownloadLog(ctx, blobURL, offset, os.Stdout)
+		if err != nil {
+			return err
 		}
 		if !app.Follow {
 			break
@@ -212,3 +118,70 @@ func (app *AppBuilderShowLogs) RunE(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// ShowParsedLog shows summary or customizer lines of the parsed log blob
+func (app *AppBuilderShowLogs) ShowParsedLog(ctx context.Context, blobURL azblob.AppendBlobURL) error {
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	// Customizer names are used to label customizer phases
+	var names []string
+	templatesClient := virtualmachineimagebuilder.NewVirtualMachineImageTemplatesClient(app.Config.SubscriptionID)
+	templatesClient.Authorizer = authorizer
+	template, err := templatesClient.Get(ctx, app.Config.Builder.ResourceGroup, app.Config.Builder.BuilderName)
+	if err != nil {
+		app.Logf("Warning: %s", err)
+	} else if template.ImageTemplateProperties != nil && template.Customize != nil {
+		names = CustomizerNames(*template.Customize)
+	}
+
+	app.Logf("Getting %s", blobURL)
+	buf := &bytes.Buffer{}
+	_, err = app.BuilderDownloadLog(ctx, blobURL, 0, buf)
+	if err != nil {
+		return err
+	}
+	phases, err := packerlog.Parse(buf, names)
+	if err != nil {
+		return err
+	}
+
+	if app.Customizer != "" {
+		found := false
+		for _, p := range phases {
+			if p.Match(app.Customizer) {
+				found = true
+				for _, l := range p.Lines {
+					fmt.Println(l.Text)
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("customizer %q not found in log", app.Customizer)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PHASE\tSTART\tDURATION\tLINES\tERRORS")
+	for _, p := range phases {
+		start := "-"
+		if !p.Start.IsZero() {
+			start = p.Start.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\n", p.Title(), start, p.Duration(), len(p.Lines), len(p.Errors))
+	}
+	w.Flush()
+	for _, p := range phases {
+		if len(p.Errors) > 0 {
+			fmt.Printf("\nErrors in %s:\n", p.Title())
+			for _, l := range p.Errors {
+				fmt.Println(l.Text)
+			}
+		}
+	}
+
+	return nil
+}
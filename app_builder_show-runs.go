@@ -32,12 +32,17 @@ func (app *AppBuilderShowRuns) Cmd() *cobra.Command {
 // RunE is main routine for app builder show-runs
 func (app *AppBuilderShowRuns) RunE(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
+	app.LogBuilderName()
+	return app.ShowRunOutputs(ctx)
+}
+
+// ShowRunOutputs shows image template run outputs
+func (app *AppBuilder) ShowRunOutputs(ctx context.Context) error {
 	authorizer, err := app.ARMAuthorizer()
 	if err != nil {
 		return err
 	}
 
-	app.LogBuilderName()
 	app.Log("Getting image template run outputs...")
 	templatesClient := virtualmachineimagebuilder.NewVirtualMachineImageTemplatesClient(app.Config.SubscriptionID)
 	templatesClient.Authorizer = authorizer
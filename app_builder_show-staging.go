@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+// AppBuilderShowStaging is app builder show-staging command
+type AppBuilderShowStaging struct {
+	*AppBuilder
+}
+
+// AppBuilderShowStagingCmder returns Cmder for app builder show-staging
+func (app *AppBuilder) AppBuilderShowStagingCmder() cmder.Cmder {
+	return &AppBuilderShowStaging{AppBuilder: app}
+}
+
+// Cmd returns Command for app builder show-staging
+func (app *AppBuilderShowStaging) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "show-staging",
+		Short:        "Show image builder staging resources",
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	return cmd
+}
+
+// RunE is main routine for app builder show-staging
+func (app *AppBuilderShowStaging) RunE(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	app.LogBuilderName()
+	app.Log("Getting image builder staging resources...")
+	group, err := app.BuilderStagingGroup(ctx)
+	if err != nil {
+		return err
+	}
+
+	m := map[string]interface{}{}
+	m["resourceGroup"] = group.Name
+	m["location"] = group.Location
+	m["tags"] = group.Tags
+
+	account, err := app.BuilderStagingAccount(ctx, group)
+	if err != nil {
+		app.Logf("Warning: %s", err)
+	} else {
+		m["storageAccount"] = account.Name
+	}
+
+	groupResources, err := app.BuilderStagingResources(ctx, group)
+	if err != nil {
+		return err
+	}
+	var resourceIDs []string
+	for _, r := range groupResources {
+		resourceIDs = append(resourceIDs, *r.ID)
+	}
+	m["resources"] = resourceIDs
+
+	app.Dump(m)
+
+	return nil
+}
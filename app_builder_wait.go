@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-03-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/virtualmachineimagebuilder/mgmt/2020-02-14/virtualmachineimagebuilder"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+// Exit codes for image build run states
+const (
+	ExitCodeRunFailed             = 1
+	ExitCodeRunPartiallySucceeded = 2
+	ExitCodeRunCanceled           = 3
+	ExitCodeRunTimedOut           = 4
+)
+
+// AppBuilderWait is app builder wait command
+type AppBuilderWait struct {
+	*AppBuilder
+	Interval time.Duration
+	All      bool
+	Parallel int
+}
+
+// AppBuilderWaitCmder returns Cmder for app builder wait
+func (app *AppBuilder) AppBuilderWaitCmder() cmder.Cmder {
+	return &AppBuilderWait{AppBuilder: app}
+}
+
+// Cmd returns Command for app builder wait
+func (app *AppBuilderWait) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "wait",
+		Short: "Wait for image build completion",
+		Long: fmt.Sprintf(`Wait for image build completion by polling the last run status.
+Exit code: 0 (Succeeded), %d (Failed), %d (PartiallySucceeded), %d (Canceled), %d (timed out)`,
+			ExitCodeRunFailed, ExitCodeRunPartiallySucceeded, ExitCodeRunCanceled, ExitCodeRunTimedOut),
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	cmd.Flags().DurationVarP(&app.Interval, "interval", "", 30*time.Second, "polling interval")
+	cmd.Flags().BoolVarP(&app.All, "all", "", false, "wait for image builds of all matrix cells")
+	ParallelFlag(cmd, &app.Parallel)
+	return cmd
+}
+
+// RunE is main routine for app builder wait
+func (app *AppBuilderWait) RunE(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	var timeout time.Duration
+	if app.Timeout != "" {
+		d, err := time.ParseDuration(app.Timeout)
+		if err != nil {
+			return err
+		}
+		timeout = d
+	}
+
+	if app.All {
+		return app.ForEachCell(ctx, app.Parallel, func(b *AppBuilder) error {
+			return b.WaitForRunState(ctx, app.Interval, timeout)
+		})
+	}
+	return app.WaitForRunState(ctx, app.Interval, timeout)
+}
+
+// WaitForRunState waits for the run and returns error with exit code for the final run state
+func (app *AppBuilder) WaitForRunState(ctx context.Context, interval, timeout time.Duration) error {
+	app.LogBuilderName()
+	status, err := app.WaitForRun(ctx, interval, timeout)
+	if err != nil {
+		return err
+	}
+	app.Dump(status)
+	err = app.UpdateManifestRun(ctx)
+	if err != nil {
+		app.Logf("Warning: manifest: %s", err)
+	}
+
+	if status.RunState == virtualmachineimagebuilder.RunStateSucceeded || status.RunState == virtualmachineimagebuilder.RunStatePartiallySucceeded {
+		err = app.ApplyGalleryTargetRegions(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return RunStateError(status.RunState)
+}
+
+// ApplyGalleryTargetRegions applies per-region replication settings to the gallery image version of the last run
+func (app *AppBuilder) ApplyGalleryTargetRegions(ctx context.Context) error {
+	// Image Builder distributes to region names only
+	perRegion := false
+	for _, r := range app.Config.Gallery.ReplicationRegions {
+		if r.ReplicaCount > 0 || r.StorageAccountType != "" {
+			perRegion = true
+			break
+		}
+	}
+	if !perRegion || app.Config.Gallery.SkipCreate || !app.GalleryValid() {
+		return nil
+	}
+
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	templatesClient := virtualmachineimagebuilder.NewVirtualMachineImageTemplatesClient(app.Config.SubscriptionID)
+	templatesClient.Authorizer = authorizer
+	runOutput, err := templatesClient.GetRunOutput(ctx, app.Config.Builder.ResourceGroup, app.Config.Builder.BuilderName, "SharedImage")
+	if err != nil {
+		return err
+	}
+	if runOutput.RunOutputProperties == nil || runOutput.ArtifactID == nil {
+		return fmt.Errorf("run output SharedImage has no artifact ID")
+	}
+	artifactID := *runOutput.ArtifactID
+	name := artifactID[strings.LastIndex(artifactID, "/")+1:]
+
+	versionsClient := compute.NewGalleryImageVersionsClient(app.Config.SubscriptionID)
+	versionsClient.Authorizer = authorizer
+	version, err := versionsClient.Get(ctx, app.Config.Gallery.ResourceGroup, app.Config.Gallery.GalleryName, app.Config.Gallery.GalleryImageName, name, "")
+	if err != nil {
+		return err
+	}
+
+	targetRegions := app.GalleryTargetRegions(*version.Location, app.GalleryReplicationRegionNames())
+	profile := &compute.GalleryImageVersionPublishingProfile{
+		TargetRegions: &targetRegions,
+	}
+	if app.Config.Gallery.ReplicaCount > 0 {
+		profile.ReplicaCount = to.Int32Ptr(app.Config.Gallery.ReplicaCount)
+	}
+	app.Logf("Gallery: applying per-region replication settings to version %s", name)
+	versionUpdate := compute.GalleryImageVersionUpdate{
+		GalleryImageVersionProperties: &compute.GalleryImageVersionProperties{
+			PublishingProfile: profile,
+		},
+	}
+	versionFuture, err := versionsClient.Update(ctx, app.Config.Gallery.ResourceGroup, app.Config.Gallery.GalleryName, app.Config.Gallery.GalleryImageName, name, versionUpdate)
+	if err != nil {
+		return err
+	}
+	return app.WaitForCompletion(ctx, &versionFuture, versionsClient.Client)
+}
+
+// WaitForRun polls the last run status until the run finishes (zero timeout means no limit)
+func (app *AppBuilder) WaitForRun(ctx context.Context, interval, timeout time.Duration) (*virtualmachineimagebuilder.ImageTemplateLastRunStatus, error) {
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return nil, err
+	}
+
+	templatesClient := virtualmachineimagebuilder.NewVirtualMachineImageTemplatesClient(app.Config.SubscriptionID)
+	templatesClient.Authorizer = authorizer
+
+	if timeout > 0 {
+		app.Logf("Waiting for image build... (checking every %s up to %s)", interval, timeout)
+	} else {
+		app.Logf("Waiting for image build... (checking every %s)", interval)
+	}
+	deadline := time.Now().Add(timeout)
+	last := ""
+	for {
+		template, err := templatesClient.Get(ctx, app.Config.Builder.ResourceGroup, app.Config.Builder.BuilderName)
+		if err != nil {
+			return nil, err
+		}
+		status := template.LastRunStatus
+		if status == nil {
+			return nil, fmt.Errorf("image template has not been run")
+		}
+		state := fmt.Sprintf("%s/%s", status.RunState, status.RunSubState)
+		if state != last {
+			elapsed := ""
+			if status.StartTime != nil {
+				end := time.Now()
+				if status.EndTime != nil && status.EndTime.After(status.StartTime.Time) {
+					end = status.EndTime.Time
+				}
+				elapsed = fmt.Sprintf(" (elapsed %s)", end.Sub(status.StartTime.Time).Round(time.Second))
+			}
+			app.Logf("Run state: %s%s", state, elapsed)
+			last = state
+		}
+		switch status.RunState {
+		case virtualmachineimagebuilder.RunStateRunning, virtualmachineimagebuilder.RunStateCanceling:
+		default:
+			return status, nil
+		}
+		if timeout > 0 && !time.Now().Add(interval).Before(deadline) {
+			return status, &ExitError{Code: ExitCodeRunTimedOut, Err: fmt.Errorf("timed out")}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// RunStateError returns error with exit code for the run state
+func RunStateError(state virtualmachineimagebuilder.RunState) error {
+	switch state {
+	case virtualmachineimagebuilder.RunStateSucceeded:
+		return nil
+	case virtualmachineimagebuilder.RunStatePartiallySucceeded:
+		return &ExitError{Code: ExitCodeRunPartiallySucceeded, Err: fmt.Errorf("image build %s", state)}
+	case virtualmachineimagebuilder.RunStateCanceled:
+		return &ExitError{Code: ExitCodeRunCanceled, Err: fmt.Errorf("image build %s", state)}
+	}
+	return &ExitError{Code: ExitCodeRunFailed, Err: fmt.Errorf("image build %s", state)}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-03-01/compute"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+// AppGallery is app gallery command
+type AppGallery struct {
+	*App
+	Timeout string
+}
+
+// AppGalleryCmder returns Cmder for app gallery
+func (app *App) AppGalleryCmder() cmder.Cmder {
+	return &AppGallery{App: app}
+}
+
+// Cmd returns Command for app gallery
+func (app *AppGallery) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "gallery",
+		Short:        "Shared Image Gallery",
+		SilenceUsage: true,
+	}
+	cmd.PersistentFlags().StringVarP(&app.Timeout, "timeout", "", "", "wait time out for completion")
+	return cmd
+}
+
+// LogGalleryImageName shows current gallery image name
+func (app *AppGallery) LogGalleryImageName() {
+	app.Logf("Current gallery image name: %s/%s", app.Config.Gallery.GalleryName, app.Config.Gallery.GalleryImageName)
+}
+
+// WaitForCompletion calls FutureAPI function with proper timeout setting
+func (app *AppGallery) WaitForCompletion(ctx context.Context, future azure.FutureAPI, client autorest.Client) error {
+	return app.WaitForFuture(ctx, future, client, app.Timeout)
+}
+
+// UpdateVersion updates publishing profile of the gallery image version
+func (app *AppGallery) UpdateVersion(ctx context.Context, name string, profile *compute.GalleryImageVersionPublishingProfile) error {
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	versionsClient := compute.NewGalleryImageVersionsClient(app.Config.SubscriptionID)
+	versionsClient.Authorizer = authorizer
+	versionUpdate := compute.GalleryImageVersionUpdate{
+		GalleryImageVersionProperties: &compute.GalleryImageVersionProperties{
+			PublishingProfile: profile,
+		},
+	}
+	versionFuture, err := versionsClient.Update(ctx, app.Config.Gallery.ResourceGroup, app.Config.Gallery.GalleryName, app.Config.Gallery.GalleryImageName, name, versionUpdate)
+	if err != nil {
+		return err
+	}
+
+	return app.WaitForCompletion(ctx, &versionFuture, versionsClient.Client)
+}
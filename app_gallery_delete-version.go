@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-03-01/compute"
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+// AppGalleryDeleteVersion is app gallery delete-version command
+type AppGalleryDeleteVersion struct {
+	*AppGallery
+	Keep int
+}
+
+// AppGalleryDeleteVersionCmder returns Cmder for app gallery delete-version
+func (app *AppGallery) AppGalleryDeleteVersionCmder() cmder.Cmder {
+	return &AppGalleryDeleteVersion{AppGallery: app}
+}
+
+// Cmd returns Command for app gallery delete-version
+func (app *AppGalleryDeleteVersion) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "delete-version [VERSION...]",
+		Short:        "Delete gallery image versions",
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	cmd.Flags().IntVarP(&app.Keep, "keep", "", -1, "delete all succeeded versions but the latest N succeeded versions")
+	return cmd
+}
+
+// RunE is main routine for app gallery delete-version
+func (app *AppGalleryDeleteVersion) RunE(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	if len(args) > 0 && app.Keep >= 0 {
+		return fmt.Errorf("specify either versions or --keep")
+	}
+
+	app.LogGalleryImageName()
+	names := args
+	if app.Keep >= 0 {
+		versions, err := app.GalleryImageVersions(ctx)
+		if err != nil {
+			return err
+		}
+		// Versions being created or replicated are neither deleted nor counted
+		var succeeded []string
+		for _, v := range versions {
+			if v.Name != nil && v.GalleryImageVersionProperties != nil && v.ProvisioningState == compute.ProvisioningState3Succeeded {
+				succeeded = append(succeeded, *v.Name)
+			}
+		}
+		for i := 0; i < len(succeeded)-app.Keep; i++ {
+			names = append(names, succeeded[i])
+		}
+	}
+	if len(names) == 0 {
+		app.Log("No versions to delete")
+		return nil
+	}
+
+	for _, name := range names {
+		app.Logf("  %s", name)
+	}
+	app.Prompt("Versions to delete: %d", len(names))
+
+	versionsClient := compute.NewGalleryImageVersionsClient(app.Config.SubscriptionID)
+	versionsClient.Authorizer = authorizer
+	for _, name := range names {
+		app.Logf("Deleting gallery image version %s...", name)
+		versionFuture, err := versionsClient.Delete(ctx, app.Config.Gallery.ResourceGroup, app.Config.Gallery.GalleryName, app.Config.Gallery.GalleryImageName, name)
+		if err != nil {
+			return err
+		}
+		err = app.WaitForCompletion(ctx, &versionFuture, versionsClient.Client)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+// AppGalleryListVersions is app gallery list-versions command
+type AppGalleryListVersions struct {
+	*AppGallery
+}
+
+// AppGalleryListVersionsCmder returns Cmder for app gallery list-versions
+func (app *AppGallery) AppGalleryListVersionsCmder() cmder.Cmder {
+	return &AppGalleryListVersions{AppGallery: app}
+}
+
+// Cmd returns Command for app gallery list-versions
+func (app *AppGalleryListVersions) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "list-versions",
+		Short:        "List gallery image versions",
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	return cmd
+}
+
+// RunE is main routine for app gallery list-versions
+func (app *AppGalleryListVersions) RunE(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	app.LogGalleryImageName()
+	app.Log("Getting gallery image versions...")
+	versions, err := app.GalleryImageVersions(ctx)
+	if err != nil {
+		return err
+	}
+
+	type versionOutput map[string]interface{}
+	var versionOutputs []versionOutput
+	for _, v := range versions {
+		m := versionOutput{}
+		m["name"] = v.Name
+		if p := v.GalleryImageVersionProperties; p != nil {
+			m["provisioningState"] = p.ProvisioningState
+			if pp := p.PublishingProfile; pp != nil {
+				if pp.PublishedDate != nil {
+					m["publishedDate"] = pp.PublishedDate
+				}
+				if pp.EndOfLifeDate != nil {
+					m["endOfLifeDate"] = pp.EndOfLifeDate
+				}
+				if pp.ExcludeFromLatest != nil {
+					m["excludeFromLatest"] = pp.ExcludeFromLatest
+				}
+				if pp.TargetRegions != nil {
+					var regions []string
+					for _, r := range *pp.TargetRegions {
+						regions = append(regions, *r.Name)
+					}
+					m["targetRegions"] = regions
+				}
+			}
+		}
+		versionOutputs = append(versionOutputs, m)
+	}
+
+	app.Dump(versionOutputs)
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-03-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+// AppGalleryReplicate is app gallery replicate command
+type AppGalleryReplicate struct {
+	*AppGallery
+	Regions []string
+}
+
+// AppGalleryReplicateCmder returns Cmder for app gallery replicate
+func (app *AppGallery) AppGalleryReplicateCmder() cmder.Cmder {
+	return &AppGalleryReplicate{AppGallery: app}
+}
+
+// Cmd returns Command for app gallery replicate
+func (app *AppGalleryReplicate) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "replicate VERSION",
+		Short:        "Replicate gallery image version to regions",
+		Args:         cobra.ExactArgs(1),
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	cmd.Flags().StringSliceVarP(&app.Regions, "regions", "", nil, "target regions (comma separated, default configured regions)")
+	return cmd
+}
+
+// RunE is main routine for app gallery replicate
+func (app *AppGalleryReplicate) RunE(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	app.LogGalleryImageName()
+	versionsClient := compute.NewGalleryImageVersionsClient(app.Config.SubscriptionID)
+	versionsClient.Authorizer = authorizer
+	version, err := versionsClient.Get(ctx, app.Config.Gallery.ResourceGroup, app.Config.Gallery.GalleryName, app.Config.Gallery.GalleryImageName, args[0], "")
+	if err != nil {
+		return err
+	}
+
+	names := app.Regions
+	if len(names) == 0 {
+		names = app.GalleryReplicationRegionNames()
+	}
+	targetRegions := app.GalleryTargetRegions(*version.Location, names)
+	var regions []string
+	for _, r := range targetRegions {
+		regions = append(regions, *r.Name)
+	}
+
+	app.Logf("Replicating gallery image version %s to %s...", args[0], strings.Join(regions, ","))
+	profile := &compute.GalleryImageVersionPublishingProfile{
+		TargetRegions: &targetRegions,
+	}
+	if app.Config.Gallery.ReplicaCount > 0 {
+		profile.ReplicaCount = to.Int32Ptr(app.Config.Gallery.ReplicaCount)
+	}
+
+	return app.UpdateVersion(ctx, args[0], profile)
+}
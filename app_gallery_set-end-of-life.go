@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-03-01/compute"
+	"github.com/Azure/go-autorest/autorest/date"
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+// AppGallerySetEndOfLife is app gallery set-end-of-life command
+type AppGallerySetEndOfLife struct {
+	*AppGallery
+}
+
+// AppGallerySetEndOfLifeCmder returns Cmder for app gallery set-end-of-life
+func (app *AppGallery) AppGallerySetEndOfLifeCmder() cmder.Cmder {
+	return &AppGallerySetEndOfLife{AppGallery: app}
+}
+
+// Cmd returns Command for app gallery set-end-of-life
+func (app *AppGallerySetEndOfLife) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "set-end-of-life VERSION DATE",
+		Short:        "Set end of life date of gallery image version (YYYY-MM-DD or RFC3339)",
+		Args:         cobra.ExactArgs(2),
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	return cmd
+}
+
+// RunE is main routine for app gallery set-end-of-life
+func (app *AppGallerySetEndOfLife) RunE(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	t, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		t, err = time.Parse("2006-01-02", args[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	app.LogGalleryImageName()
+	app.Logf("Setting end of life date of gallery image version %s to %s...", args[0], t.Format(time.RFC3339))
+	profile := &compute.GalleryImageVersionPublishingProfile{
+		EndOfLifeDate: &date.Time{Time: t},
+	}
+
+	return app.UpdateVersion(ctx, args[0], profile)
+}
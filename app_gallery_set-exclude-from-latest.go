@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-03-01/compute"
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+// AppGallerySetExcludeFromLatest is app gallery set-exclude-from-latest command
+type AppGallerySetExcludeFromLatest struct {
+	*AppGallery
+}
+
+// AppGallerySetExcludeFromLatestCmder returns Cmder for app gallery set-exclude-from-latest
+func (app *AppGallery) AppGallerySetExcludeFromLatestCmder() cmder.Cmder {
+	return &AppGallerySetExcludeFromLatest{AppGallery: app}
+}
+
+// Cmd returns Command for app gallery set-exclude-from-latest
+func (app *AppGallerySetExcludeFromLatest) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "set-exclude-from-latest VERSION true|false",
+		Short:        "Set excludeFromLatest of gallery image version",
+		Args:         cobra.ExactArgs(2),
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	return cmd
+}
+
+// RunE is main routine for app gallery set-exclude-from-latest
+func (app *AppGallerySetExcludeFromLatest) RunE(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	exclude, err := strconv.ParseBool(args[1])
+	if err != nil {
+		return err
+	}
+
+	app.LogGalleryImageName()
+	app.Logf("Setting excludeFromLatest of gallery image version %s to %t...", args[0], exclude)
+	profile := &compute.GalleryImageVersionPublishingProfile{
+		ExcludeFromLatest: &exclude,
+	}
+
+	return app.UpdateVersion(ctx, args[0], profile)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-03-01/compute"
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+// AppGalleryShowVersion is app gallery show-version command
+type AppGalleryShowVersion struct {
+	*AppGallery
+}
+
+// AppGalleryShowVersionCmder returns Cmder for app gallery show-version
+func (app *AppGallery) AppGalleryShowVersionCmder() cmder.Cmder {
+	return &AppGalleryShowVersion{AppGallery: app}
+}
+
+// Cmd returns Command for app gallery show-version
+func (app *AppGalleryShowVersion) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "show-version VERSION",
+		Short:        "Show gallery image version",
+		Args:         cobra.ExactArgs(1),
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	return cmd
+}
+
+// RunE is main routine for app gallery show-version
+func (app *AppGalleryShowVersion) RunE(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	app.LogGalleryImageName()
+	app.Logf("Getting gallery image version %s...", args[0])
+	versionsClient := compute.NewGalleryImageVersionsClient(app.Config.SubscriptionID)
+	versionsClient.Authorizer = authorizer
+	version, err := versionsClient.Get(ctx, app.Config.Gallery.ResourceGroup, app.Config.Gallery.GalleryName, app.Config.Gallery.GalleryImageName, args[0], compute.ReplicationStatusTypesReplicationStatus)
+	if err != nil {
+		return err
+	}
+
+	app.Dump(version)
+
+	return nil
+}
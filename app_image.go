@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+// AppImage is app image command
+type AppImage struct {
+	*App
+}
+
+// AppImageCmder returns Cmder for app image
+func (app *App) AppImageCmder() cmder.Cmder {
+	return &AppImage{App: app}
+}
+
+// Cmd returns Command for app image
+func (app *AppImage) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "image",
+		Short:        "Built image validation",
+		SilenceUsage: true,
+	}
+	return cmd
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-03-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+
+	"github.com/yaegashi/customazed/utils/inpututil"
+)
+
+// AppImageTest is app image test command
+type AppImageTest struct {
+	*AppImage
+	Input         string
+	Image         string
+	Location      string
+	ResourceGroup string
+	Size          string
+	Timeout       string
+	Keep          bool
+}
+
+// AppImageTestCmder returns Cmder for app image test
+func (app *AppImage) AppImageTestCmder() cmder.Cmder {
+	return &AppImageTest{AppImage: app}
+}
+
+// Cmd returns Command for app image test
+func (app *AppImageTest) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "test",
+		Aliases:      []string{"validate"},
+		Short:        "Boot temporary VM from image and run validation script",
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	cmd.Flags().StringVarP(&app.Input, "input", "i", "customazed_test.json", "input file path")
+	cmd.Flags().StringVarP(&app.Image, "image", "", "", fmt.Sprintf("managed image ID, gallery image version ID or %s<rg>/<gallery>/<image>@<version> (default: configured image or gallery)", GallerySourcePrefix))
+	cmd.Flags().StringVarP(&app.Location, "location", "", "", "location of test VM (default: image location)")
+	cmd.Flags().StringVarP(&app.ResourceGroup, "resource-group", "", "", "temporary resource group name, which must not exist (default: random)")
+	cmd.Flags().StringVarP(&app.Size, "size", "", imageTestVMSize, "test VM size")
+	cmd.Flags().StringVarP(&app.Timeout, "timeout", "", "30m", "timeout for validation script")
+	cmd.Flags().BoolVarP(&app.Keep, "keep", "", false, "keep temporary resource group after test")
+	return cmd
+}
+
+// RunE is main routine for app image test
+func (app *AppImageTest) RunE(cmd *cobra.Command, args []string) (rErr error) {
+	// Interrupt stops the test, then temporary resources are deleted
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if d, err := time.ParseDuration(app.Timeout); err != nil || d <= 0 {
+		return fmt.Errorf("invalid timeout: %q", app.Timeout)
+	}
+
+	imageName := app.Image
+	if imageName == "" {
+		var err error
+		imageName, err = app.ImageTestDefaultImage(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	image, err := app.ImageTestGetImage(ctx, imageName)
+	if err != nil {
+		return err
+	}
+	location := app.Location
+	if location == "" {
+		location = image.DefaultLocation()
+	} else if !image.HasRegion(location) {
+		return fmt.Errorf("image %s is not replicated to %s: available in %s", image.ID, location, strings.Join(image.Regions, ", "))
+	}
+	groupName := app.ResourceGroup
+	if groupName == "" {
+		groupName = ImageTestResourceGroupName()
+	}
+	err = app.ImageTestCheckGroup(ctx, groupName)
+	if err != nil {
+		return err
+	}
+
+	app.Logf("Loading custom script settings %s", app.Input)
+	var settings *CustomScriptSettings
+	err = inpututil.UnmarshalJSONC(app.Input, &settings)
+	if err != nil {
+		return err
+	}
+
+	if settings.Timestamp == 0 {
+		settings.Timestamp = int(time.Now().Unix())
+	}
+
+	su := app.NewStorageUploader(ctx)
+	tv := app.NewTemplateVariable(su)
+	err = tv.Resolve(settings)
+	if err != nil {
+		return err
+	}
+
+	extensionParams, err := NewCustomScriptExtensionWithSettings(location, image.OSType, settings)
+	if err != nil {
+		return err
+	}
+
+	app.Dump(settings)
+	app.Logf("Image: %s (%s, HyperVGeneration=%s, SecurityType=%s)", image.ID, image.OSType, image.HyperVGeneration, image.SecurityType)
+	app.Logf("Test VM: %s in %s (%s)", app.Size, groupName, location)
+	app.Prompt("Files to upload: %d", su.Files())
+
+	if su.Valid() && su.Files() > 0 {
+		err = su.Execute(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Only the resource group created here is deleted after test
+	err = app.ImageTestCreateGroup(ctx, groupName, location)
+	if err != nil {
+		return err
+	}
+
+	roleAssignmentID := ""
+	defer func() {
+		if app.Keep {
+			app.Logf("Image test: keeping resource group: %s", groupName)
+			return
+		}
+		// Another interrupt aborts cleanup
+		stop()
+		err := app.ImageTestCleanup(context.Background(), groupName, roleAssignmentID)
+		if err != nil {
+			app.Logf("Warning: cleanup: %s", err)
+			if rErr == nil {
+				rErr = &ExitError{Code: 1, Err: fmt.Errorf("image test cleanup failed: %s", err)}
+			}
+		}
+	}()
+
+	roleAssignmentID, err = app.RunTest(ctx, groupName, location, image, extensionParams)
+	if err != nil {
+		app.Log("Image test: Failure")
+		return &ExitError{Code: 1, Err: fmt.Errorf("image test failed: %s", err)}
+	}
+	app.Log("Image test: Success")
+	return nil
+}
+
+// RunTest creates test VM and runs custom script extension on it, returning role assignment ID to clean up
+func (app *AppImageTest) RunTest(ctx context.Context, groupName, location string, image *ImageTestImage, extensionParams *compute.VirtualMachineExtension) (string, error) {
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return "", err
+	}
+
+	machine, err := app.ImageTestCreateMachine(ctx, groupName, location, app.Size, image)
+	if err != nil {
+		return "", err
+	}
+
+	roleAssignmentID, err := app.ImageTestAssignRole(ctx, machine)
+	if err != nil {
+		return roleAssignmentID, err
+	}
+
+	// Blob download fails with 403 until the new role assignment propagates,
+	// in which case the script has not run yet and is safe to retry
+	extensionsClient := compute.NewVirtualMachineExtensionsClient(app.Config.SubscriptionID)
+	extensionsClient.Authorizer = authorizer
+	for i := 0; ; i++ {
+		if i > 0 {
+			extensionParams.ForceUpdateTag = to.StringPtr(strconv.Itoa(i))
+		}
+		app.Log("Executing VM extension...")
+		extensionFuture, err := extensionsClient.CreateOrUpdate(ctx, groupName, *machine.Name, "CustomScriptExtension", *extensionParams)
+		if err != nil {
+			return roleAssignmentID, err
+		}
+		runErr := app.WaitForFuture(ctx, &extensionFuture, extensionsClient.Client, app.Timeout)
+
+		result, err := extensionsClient.Get(ctx, groupName, *machine.Name, "CustomScriptExtension", "instanceView")
+		if err == nil {
+			err = app.LogExtensionStatus(&result)
+		}
+		if err != nil {
+			app.Logf("Warning: %s", err)
+		}
+
+		if runErr == nil || i >= imageTestDownloadRetries || !ImageTestDownloadForbidden(&result) {
+			return roleAssignmentID, runErr
+		}
+		app.Logf("Image test: blob download forbidden until role assignment propagates, retrying in %s", imageTestDownloadDelay)
+		select {
+		case <-ctx.Done():
+			return roleAssignmentID, ctx.Err()
+		case <-time.After(imageTestDownloadDelay):
+		}
+	}
+}
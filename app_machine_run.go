@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-03-01/compute"
@@ -35,14 +34,6 @@ func (app *AppMachineRun) Cmd() *cobra.Command {
 	return cmd
 }
 
-// CustomScriptSettings is input object of app machine run
-type CustomScriptSettings struct {
-	FileUris         []string `json:"fileUris,omitempty"`
-	CommandToExecute string   `json:"commandToExecute,omitempty"`
-	SkipDos2Unix     bool     `json:"skipDos2Unix,omitempty"`
-	Timestamp        int      `json:"timestamp,omitempty"`
-}
-
 // RunE is main routine for app machine run
 func (app *AppMachineRun) RunE(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
@@ -74,29 +65,9 @@ func (app *AppMachineRun) RunE(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	var extensionParams *compute.VirtualMachineExtension
-	switch machine.StorageProfile.OsDisk.OsType {
-	case "Windows":
-		extensionParams = NewWindowsCustomScriptExtension(*machine.Location)
-		extensionParams.ProtectedSettings = map[string]interface{}{
-			"fileUris":         settings.FileUris,
-			"commandToExecute": settings.CommandToExecute,
-			"timestamp":        settings.Timestamp,
-			"managedIdentity":  map[string]string{},
-		}
-	case "Linux":
-		extensionParams = NewLinuxCustomScriptExtension(*machine.Location)
-		extensionParams.Settings = map[string]interface{}{
-			"skipDos2Unix": settings.SkipDos2Unix,
-			"timestamp":    settings.Timestamp,
-		}
-		extensionParams.ProtectedSettings = map[string]interface{}{
-			"fileUris":         settings.FileUris,
-			"commandToExecute": settings.CommandToExecute,
-			"managedIdentity":  map[string]string{},
-		}
-	default:
-		return fmt.Errorf("VM has unknown OS type: %s", machine.StorageProfile.OsDisk.OsType)
+	extensionParams, err := NewCustomScriptExtensionWithSettings(*machine.Location, machine.StorageProfile.OsDisk.OsType, settings)
+	if err != nil {
+		return err
 	}
 
 	app.Dump(settings)
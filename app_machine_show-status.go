@@ -2,8 +2,6 @@ package main
 
 import (
 	"context"
-	"errors"
-	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-03-01/compute"
 	"github.com/spf13/cobra"
@@ -46,24 +44,5 @@ func (app *AppMachineShowStatus) RunE(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	if result.VirtualMachineExtensionProperties.InstanceView == nil {
-		return errors.New("missing extension instance view (maybe virtual machine is not running)")
-	}
-	for _, status := range *result.VirtualMachineExtensionProperties.InstanceView.Statuses {
-		app.Logf("%s: %s\n%s", *status.Code, *status.DisplayStatus, *status.Message)
-	}
-	if result.VirtualMachineExtensionProperties.InstanceView.Substatuses != nil {
-		for _, status := range *result.VirtualMachineExtensionProperties.InstanceView.Substatuses {
-			code := strings.Split(*status.Code, "/")
-			if len(code) == 3 && code[0] == "ComponentStatus" {
-				msg := *status.Message
-				if len(msg) > 0 && msg[len(msg)-1] != '\n' {
-					msg = msg + "\n"
-				}
-				app.Logf("%s:\n%s", code[1], msg)
-			}
-		}
-	}
-
-	return nil
+	return app.LogExtensionStatus(&result)
 }
@@ -60,6 +60,10 @@ func (app *AppSetup) RunE(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	err = app.VNetSetup(ctx)
+	if err != nil {
+		return err
+	}
 	err = app.BuilderSetup(ctx)
 	if err != nil {
 		return err
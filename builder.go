@@ -2,12 +2,25 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/yaegashi/customazed/utils/inlineutil"
 	"github.com/yaegashi/customazed/utils/ssutil"
+	"github.com/yaegashi/customazed/utils/verutil"
 
 	"github.com/Azure/azure-sdk-for-go/profiles/2020-09-01/resources/mgmt/resources"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-03-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2021-04-01/storage"
 	"github.com/Azure/azure-sdk-for-go/services/virtualmachineimagebuilder/mgmt/2020-02-14/virtualmachineimagebuilder"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/Azure/go-autorest/autorest/to"
 )
 
 func (app *App) Builder(ctx context.Context) (*virtualmachineimagebuilder.ImageTemplate, error) {
@@ -53,8 +66,13 @@ func (app *App) BuilderSetup(ctx context.Context) error {
 	app.Logf("Builder: creating resource group: %s", app.Config.Builder.ResourceGroup)
 	groupsClient := resources.NewGroupsClient(app.Config.SubscriptionID)
 	groupsClient.Authorizer = authorizer
+	groupTags, err := app.GroupTags(ctx, groupsClient, app.Config.Builder.ResourceGroup, app.Config.Builder.Tags)
+	if err != nil {
+		return err
+	}
 	groupsParams := resources.Group{
 		Location: &app.Config.Builder.Location,
+		Tags:     groupTags,
 	}
 	_, err = groupsClient.CreateOrUpdate(ctx, app.Config.Builder.ResourceGroup, groupsParams)
 	if err != nil {
@@ -63,3 +81,365 @@ func (app *App) BuilderSetup(ctx context.Context) error {
 
 	return nil
 }
+
+// builderAPIVersion is the image builder API version used by the SDK package
+const builderAPIVersion = "2020-02-14"
+
+// CustomizerNames returns names of customizers (or types for unnamed ones)
+func CustomizerNames(customizes []virtualmachineimagebuilder.BasicImageTemplateCustomizer) []string {
+	var names []string
+	for _, c := range customizes {
+		var m struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		}
+		b, _ := json.Marshal(c)
+		json.Unmarshal(b, &m)
+		names = append(names, ssutil.FirstNonEmpty(m.Name, m.Type))
+	}
+	return names
+}
+
+// BuilderStagingTemplate returns image template name and resource group from staging resource group tags
+func BuilderStagingTemplate(group resources.Group) (string, string, bool) {
+	createdBy, ok := group.Tags["createdBy"]
+	if !ok || createdBy == nil || *createdBy != "AzureVMImageBuilder" {
+		return "", "", false
+	}
+	name, ok := group.Tags["imageTemplateName"]
+	if !ok || name == nil {
+		return "", "", false
+	}
+	resourceGroupName, ok := group.Tags["imageTemplateResourceGroupName"]
+	if !ok || resourceGroupName == nil {
+		return "", "", false
+	}
+	return *name, *resourceGroupName, true
+}
+
+// BuilderStagingGroups returns all staging resource groups created by Azure VM Image Builder
+func (app *App) BuilderStagingGroups(ctx context.Context) ([]resources.Group, error) {
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return nil, err
+	}
+
+	groupsClient := resources.NewGroupsClient(app.Config.SubscriptionID)
+	groupsClient.Authorizer = authorizer
+	groups, err := groupsClient.ListComplete(ctx, "tagName eq 'createdBy' and tagValue eq 'AzureVMImageBuilder'", nil)
+	if err != nil {
+		return nil, err
+	}
+	var result []resources.Group
+	for groups.NotDone() {
+		g := groups.Value()
+		if _, _, ok := BuilderStagingTemplate(g); ok {
+			result = append(result, g)
+		}
+		err := groups.NextWithContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// BuilderStagingGroup returns the staging resource group of the current image template
+func (app *App) BuilderStagingGroup(ctx context.Context) (*resources.Group, error) {
+	groups, err := app.BuilderStagingGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range groups {
+		name, resourceGroupName, _ := BuilderStagingTemplate(groups[i])
+		if strings.EqualFold(name, app.Config.Builder.BuilderName) && strings.EqualFold(resourceGroupName, app.Config.Builder.ResourceGroup) {
+			return &groups[i], nil
+		}
+	}
+	return nil, fmt.Errorf("builder resource group not found")
+}
+
+// BuilderStagingAccount returns the storage account in the staging resource group
+func (app *App) BuilderStagingAccount(ctx context.Context, group *resources.Group) (*storage.Account, error) {
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return nil, err
+	}
+
+	accountsClient := storage.NewAccountsClient(app.Config.SubscriptionID)
+	accountsClient.Authorizer = authorizer
+	accounts, err := accountsClient.ListByResourceGroupComplete(ctx, *group.Name)
+	if err != nil {
+		return nil, err
+	}
+	for accounts.NotDone() {
+		a := accounts.Value()
+		if createdby, ok := a.Tags["createdby"]; ok && createdby != nil && *createdby == "azureimagebuilder" {
+			return &a, nil
+		}
+		err := accounts.NextWithContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("builder storage account not found")
+}
+
+// BuilderStagingResources returns resources with created time in the staging resource group
+func (app *App) BuilderStagingResources(ctx context.Context, group *resources.Group) ([]resources.GenericResourceExpanded, error) {
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return nil, err
+	}
+
+	resourcesClient := resources.NewClient(app.Config.SubscriptionID)
+	resourcesClient.Authorizer = authorizer
+	result, err := resourcesClient.ListByResourceGroupComplete(ctx, *group.Name, "", "createdTime", nil)
+	if err != nil {
+		return nil, err
+	}
+	var groupResources []resources.GenericResourceExpanded
+	for result.NotDone() {
+		groupResources = append(groupResources, result.Value())
+		err := result.NextWithContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return groupResources, nil
+}
+
+// BuilderLogContainer returns packerlogs container URL in the staging storage account
+func (app *App) BuilderLogContainer(ctx context.Context) (*azblob.ContainerURL, error) {
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return nil, err
+	}
+
+	group, err := app.BuilderStagingGroup(ctx)
+	if err != nil {
+		return nil, err
+	}
+	app.Logf("Builder resource group: %s", *group.Name)
+
+	account, err := app.BuilderStagingAccount(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	app.Logf("Builder storage account: %s", *account.Name)
+
+	accountsClient := storage.NewAccountsClient(app.Config.SubscriptionID)
+	accountsClient.Authorizer = authorizer
+
+	// Get shared access keys
+	keyResult, err := accountsClient.ListKeys(ctx, *group.Name, *account.Name, "")
+	if err != nil {
+		return nil, err
+	}
+	accountKeys := *keyResult.Keys
+
+	// Find packerlogs container URL
+	credential, err := azblob.NewSharedKeyCredential(*account.Name, *accountKeys[0].Value)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{})
+	endpointURL, _ := url.Parse(*account.PrimaryEndpoints.Blob)
+	serviceURL := azblob.NewServiceURL(*endpointURL, pipeline)
+	containerURL := serviceURL.NewContainerURL("packerlogs")
+
+	return &containerURL, nil
+}
+
+// BuilderLogBlobs enumerates log blobs in packerlogs container sorted by creation time
+func (app *App) BuilderLogBlobs(ctx context.Context, containerURL *azblob.ContainerURL) ([]*azblob.BlobItemInternal, error) {
+	var blobItems []*azblob.BlobItemInternal
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		blobRes, err := containerURL.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range blobRes.Segment.BlobItems {
+			blobItems = append(blobItems, &blobRes.Segment.BlobItems[i])
+		}
+		marker = blobRes.NextMarker
+	}
+
+	sort.Slice(blobItems, func(i, j int) bool {
+		var a, b time.Time
+		if blobItems[i].Properties.CreationTime != nil {
+			a = *blobItems[i].Properties.CreationTime
+		}
+		if blobItems[j].Properties.CreationTime != nil {
+			b = *blobItems[j].Properties.CreationTime
+		}
+		return a.Before(b)
+	})
+
+	return blobItems, nil
+}
+
+// BuilderDownloadLog writes log blob content from offset and returns the new offset
+func (app *App) BuilderDownloadLog(ctx context.Context, blobURL azblob.AppendBlobURL, offset int64, w io.Writer) (int64, error) {
+	res, err := blobURL.Download(ctx, offset, azblob.CountToEnd, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		storageErr, ok := err.(azblob.StorageError)
+		if !ok || storageErr.Response().StatusCode != http.StatusRequestedRangeNotSatisfiable {
+			return offset, err
+		}
+		return offset, nil
+	}
+	n, err := io.Copy(w, res.Body(azblob.RetryReaderOptions{}))
+	res.Response().Body.Close()
+	return offset + n, err
+}
+
+// BuilderSource returns the concrete pointer type of the image template source
+func BuilderSource(source virtualmachineimagebuilder.BasicImageTemplateSource) (virtualmachineimagebuilder.BasicImageTemplateSource, error) {
+	if source == nil {
+		return nil, fmt.Errorf("no source in image template")
+	}
+	if s, ok := source.AsImageTemplatePlatformImageSource(); ok {
+		return s, nil
+	}
+	if s, ok := source.AsImageTemplateManagedImageSource(); ok {
+		return s, nil
+	}
+	if s, ok := source.AsImageTemplateSharedImageVersionSource(); ok {
+		return s, nil
+	}
+	s, _ := source.AsImageTemplateSource()
+	return nil, fmt.Errorf("unsupported source type %q", s.Type)
+}
+
+// BuilderCustomizer returns the concrete pointer type of the image template customizer
+func BuilderCustomizer(customize virtualmachineimagebuilder.BasicImageTemplateCustomizer) (virtualmachineimagebuilder.BasicImageTemplateCustomizer, error) {
+	if c, ok := customize.AsImageTemplateShellCustomizer(); ok {
+		return c, nil
+	}
+	if c, ok := customize.AsImageTemplatePowerShellCustomizer(); ok {
+		return c, nil
+	}
+	if c, ok := customize.AsImageTemplateFileCustomizer(); ok {
+		return c, nil
+	}
+	if c, ok := customize.AsImageTemplateRestartCustomizer(); ok {
+		return c, nil
+	}
+	if c, ok := customize.AsImageTemplateWindowsUpdateCustomizer(); ok {
+		return c, nil
+	}
+	c, _ := customize.AsImageTemplateCustomizer()
+	return nil, fmt.Errorf("unsupported customizer type %q", c.Type)
+}
+
+// BuilderDistributor returns the concrete pointer type of the image template distributor
+func BuilderDistributor(distribute virtualmachineimagebuilder.BasicImageTemplateDistributor) (virtualmachineimagebuilder.BasicImageTemplateDistributor, error) {
+	if d, ok := distribute.AsImageTemplateManagedImageDistributor(); ok {
+		return d, nil
+	}
+	if d, ok := distribute.AsImageTemplateSharedImageDistributor(); ok {
+		return d, nil
+	}
+	if d, ok := distribute.AsImageTemplateVhdDistributor(); ok {
+		return d, nil
+	}
+	d, _ := distribute.AsImageTemplateDistributor()
+	return nil, fmt.Errorf("unsupported distributor type %q", d.Type)
+}
+
+// builderInline returns inline commands of shell and PowerShell customizers
+func builderInline(c virtualmachineimagebuilder.BasicImageTemplateCustomizer) *[]string {
+	switch c := c.(type) {
+	case *virtualmachineimagebuilder.ImageTemplateShellCustomizer:
+		return c.Inline
+	case *virtualmachineimagebuilder.ImageTemplatePowerShellCustomizer:
+		return c.Inline
+	}
+	return nil
+}
+
+// BuilderInlineFileEntries returns indexes of inline commands consisting of inlineFile for each customizer
+func BuilderInlineFileEntries(customizes []virtualmachineimagebuilder.BasicImageTemplateCustomizer) []map[int]bool {
+	marks := make([]map[int]bool, len(customizes))
+	for i, c := range customizes {
+		marks[i] = map[int]bool{}
+		if inline := builderInline(c); inline != nil {
+			for j, s := range *inline {
+				if inlineutil.IsInlineFile(s) {
+					marks[i][j] = true
+				}
+			}
+		}
+	}
+	return marks
+}
+
+// BuilderInlineLines expands inline commands generated by inlineFile into lines
+func BuilderInlineLines(customizes []virtualmachineimagebuilder.BasicImageTemplateCustomizer, marks []map[int]bool) error {
+	for i, c := range customizes {
+		inline := builderInline(c)
+		if inline == nil || len(marks[i]) == 0 {
+			continue
+		}
+		lines, err := inlineutil.Expand(*inline, marks[i])
+		if err != nil {
+			return err
+		}
+		*inline = lines
+	}
+	return nil
+}
+
+// BuilderPinSource replaces "latest" version of the platform image source with the exact latest version
+func (app *App) BuilderPinSource(ctx context.Context, template *virtualmachineimagebuilder.ImageTemplate) error {
+	s, ok := template.Source.(*virtualmachineimagebuilder.ImageTemplatePlatformImageSource)
+	if !ok {
+		app.Log("Builder: source is not a platform image, skipping pinning")
+		return nil
+	}
+	if s.Version != nil && !strings.EqualFold(*s.Version, "latest") {
+		app.Logf("Builder: source version already pinned: %s", *s.Version)
+		return nil
+	}
+	if ssutil.HasEmpty(to.String(s.Publisher), to.String(s.Offer), to.String(s.Sku)) {
+		return fmt.Errorf("platform image source requires publisher, offer and sku")
+	}
+
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	location := strings.ToLower(strings.ReplaceAll(to.String(template.Location), " ", ""))
+	imagesClient := compute.NewVirtualMachineImagesClient(app.Config.SubscriptionID)
+	imagesClient.Authorizer = authorizer
+	result, err := imagesClient.List(ctx, location, *s.Publisher, *s.Offer, *s.Sku, "", nil, "")
+	if err != nil {
+		return err
+	}
+	var versions []string
+	if result.Value != nil {
+		for _, r := range *result.Value {
+			if r.Name != nil {
+				versions = append(versions, *r.Name)
+			}
+		}
+	}
+	latest := verutil.Latest(versions)
+	if latest == "" {
+		return fmt.Errorf("no versions found for %s:%s:%s in %s", *s.Publisher, *s.Offer, *s.Sku, location)
+	}
+
+	s.Version = to.StringPtr(latest)
+	urn := fmt.Sprintf("%s:%s:%s:%s", *s.Publisher, *s.Offer, *s.Sku, latest)
+	app.Logf("Builder: pinned source to %s", urn)
+	if template.Tags == nil {
+		template.Tags = map[string]*string{}
+	}
+	template.Tags[TagSourceImage] = to.StringPtr(urn)
+	return nil
+}
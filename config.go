@@ -1,22 +1,28 @@
 package main
 
+import (
+	"encoding/json"
+)
+
 // StorageConfig is configuration for storage account and blob container
 type StorageConfig struct {
-	Location      string `json:"location,omitempty"`
-	ResourceGroup string `json:"resourceGroup,omitempty"`
-	AccountName   string `json:"accountName,omitempty"`
-	AccountID     string `json:"accountId,omitempty"`
-	ContainerName string `json:"containerName,omitempty"`
-	ContainerID   string `json:"containerId,omitempty"`
-	Prefix        string `json:"prefix,omitempty"`
+	Location      string            `json:"location,omitempty"`
+	ResourceGroup string            `json:"resourceGroup,omitempty"`
+	AccountName   string            `json:"accountName,omitempty"`
+	AccountID     string            `json:"accountId,omitempty"`
+	ContainerName string            `json:"containerName,omitempty"`
+	ContainerID   string            `json:"containerId,omitempty"`
+	Prefix        string            `json:"prefix,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
 }
 
 // IdentityConfig is configuration for user assigned identity
 type IdentityConfig struct {
-	Location      string `json:"location,omitempty"`
-	ResourceGroup string `json:"resourceGroup,omitempty"`
-	IdentityName  string `json:"identityName,omitempty"`
-	IdentityID    string `json:"identityId,omitempty"`
+	Location      string            `json:"location,omitempty"`
+	ResourceGroup string            `json:"resourceGroup,omitempty"`
+	IdentityName  string            `json:"identityName,omitempty"`
+	IdentityID    string            `json:"identityId,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
 }
 
 // MachineConfig is configuration for virtual machine
@@ -28,54 +34,131 @@ type MachineConfig struct {
 
 // ImageConfig is configuration for managed image
 type ImageConfig struct {
-	Location      string `json:"location,omitempty"`
-	ResourceGroup string `json:"resourceGroup,omitempty"`
-	ImageName     string `json:"imageName,omitempty"`
-	ImageID       string `json:"imageId,omitempty"`
-	SkipSetup     bool   `json:"skipSetup,omitempty"`
-	SkipCreate    bool   `json:"skipCreate,omitempty"`
+	Location      string            `json:"location,omitempty"`
+	ResourceGroup string            `json:"resourceGroup,omitempty"`
+	ImageName     string            `json:"imageName,omitempty"`
+	ImageID       string            `json:"imageId,omitempty"`
+	SkipSetup     bool              `json:"skipSetup,omitempty"`
+	SkipCreate    bool              `json:"skipCreate,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+// ResourceRangeConfig is configuration for min/max resource range
+type ResourceRangeConfig struct {
+	Min int32 `json:"min,omitempty"`
+	Max int32 `json:"max,omitempty"`
+}
+
+// GalleryRecommendedConfig is configuration for recommended machine configuration
+type GalleryRecommendedConfig struct {
+	VCPUs  ResourceRangeConfig `json:"vCPUs,omitempty"`
+	Memory ResourceRangeConfig `json:"memory,omitempty"`
+}
+
+// GalleryPurchasePlanConfig is configuration for gallery image purchase plan
+type GalleryPurchasePlanConfig struct {
+	Name      string `json:"name,omitempty"`
+	Publisher string `json:"publisher,omitempty"`
+	Product   string `json:"product,omitempty"`
+}
+
+// GalleryRegionConfig is configuration for gallery image version target region
+type GalleryRegionConfig struct {
+	Name               string `json:"name,omitempty"`
+	ReplicaCount       int32  `json:"replicaCount,omitempty"`
+	StorageAccountType string `json:"storageAccountType,omitempty"`
+}
+
+// UnmarshalJSON accepts either a region name string or a region object
+func (r *GalleryRegionConfig) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*r = GalleryRegionConfig{Name: name}
+		return nil
+	}
+	type plain GalleryRegionConfig
+	return json.Unmarshal(b, (*plain)(r))
 }
 
 // GalleryConfig is configuration for shared image gallery
 type GalleryConfig struct {
-	Location           string   `json:"location,omitempty"`
-	ResourceGroup      string   `json:"resourceGroup,omitempty"`
-	GalleryName        string   `json:"galleryName,omitempty"`
-	GalleryID          string   `json:"galleryId,omitempty"`
-	GalleryImageName   string   `json:"galleryImageName,omitempty"`
-	GalleryImageID     string   `json:"galleryImageId,omitempty"`
-	Publisher          string   `json:"publisher,omitempty"`
-	Offer              string   `json:"offer,omitempty"`
-	SKU                string   `json:"sku,omitempty"`
-	OSState            string   `json:"osState,omitempty"`
-	OSType             string   `json:"osType,omitempty"`
-	ReplicationRegions []string `json:"replicationRegions,omitempty"`
-	ExcludeFromLatest  bool     `json:"excludeFromLatest,omitempty"`
-	StorageAccountType string   `json:"storageAccountType,omitempty"`
-	SkipSetup          bool     `json:"skipSetup,omitempty"`
-	SkipCreate         bool     `json:"skipCreate,omitempty"`
+	Location           string                    `json:"location,omitempty"`
+	ResourceGroup      string                    `json:"resourceGroup,omitempty"`
+	GalleryName        string                    `json:"galleryName,omitempty"`
+	GalleryID          string                    `json:"galleryId,omitempty"`
+	GalleryImageName   string                    `json:"galleryImageName,omitempty"`
+	GalleryImageID     string                    `json:"galleryImageId,omitempty"`
+	Publisher          string                    `json:"publisher,omitempty"`
+	Offer              string                    `json:"offer,omitempty"`
+	SKU                string                    `json:"sku,omitempty"`
+	OSState            string                    `json:"osState,omitempty"`
+	OSType             string                    `json:"osType,omitempty"`
+	HyperVGeneration   string                    `json:"hyperVGeneration,omitempty"`
+	Features           map[string]string         `json:"features,omitempty"`
+	Recommended        GalleryRecommendedConfig  `json:"recommended,omitempty"`
+	PurchasePlan       GalleryPurchasePlanConfig `json:"purchasePlan,omitempty"`
+	Eula               string                    `json:"eula,omitempty"`
+	ReleaseNoteURI     string                    `json:"releaseNoteUri,omitempty"`
+	Description        string                    `json:"description,omitempty"`
+	ReplicationRegions []GalleryRegionConfig     `json:"replicationRegions,omitempty"`
+	ReplicaCount       int32                     `json:"replicaCount,omitempty"`
+	ExcludeFromLatest  bool                      `json:"excludeFromLatest,omitempty"`
+	StorageAccountType string                    `json:"storageAccountType,omitempty"`
+	SkipSetup          bool                      `json:"skipSetup,omitempty"`
+	SkipCreate         bool                      `json:"skipCreate,omitempty"`
+	Tags               map[string]string         `json:"tags,omitempty"`
+}
+
+// VHDConfig is configuration for VHD distribution
+type VHDConfig struct {
+	Enabled       bool              `json:"enabled,omitempty"`
+	ContainerName string            `json:"containerName,omitempty"`
+	BlobName      string            `json:"blobName,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+// VNetConfig is configuration for virtual network of image builder VM.
+// SubnetID may refer to another subscription. Proxy VM size is not configurable with image builder API 2020-02-14.
+type VNetConfig struct {
+	Location      string            `json:"location,omitempty"`
+	ResourceGroup string            `json:"resourceGroup,omitempty"`
+	VNetName      string            `json:"vnetName,omitempty"`
+	SubnetName    string            `json:"subnetName,omitempty"`
+	AddressPrefix string            `json:"addressPrefix,omitempty"`
+	SubnetPrefix  string            `json:"subnetPrefix,omitempty"`
+	SubnetID      string            `json:"subnetId,omitempty"`
+	SkipSetup     bool              `json:"skipSetup,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
 }
 
 // BuilderConfig is configuration for image template
 type BuilderConfig struct {
-	Location      string `json:"location,omitempty"`
-	ResourceGroup string `json:"resourceGroup,omitempty"`
-	BuilderName   string `json:"builderName,omitempty"`
-	BuilderID     string `json:"builderId,omitempty"`
+	Location              string            `json:"location,omitempty"`
+	ResourceGroup         string            `json:"resourceGroup,omitempty"`
+	BuilderName           string            `json:"builderName,omitempty"`
+	BuilderID             string            `json:"builderId,omitempty"`
+	VMSize                string            `json:"vmSize,omitempty"`
+	OSDiskSizeGB          int32             `json:"osDiskSizeGB,omitempty"`
+	BuildTimeoutInMinutes int32             `json:"buildTimeoutInMinutes,omitempty"`
+	Tags                  map[string]string `json:"tags,omitempty"`
 }
 
 // Config is configuration for application
 type Config struct {
-	ID             string            `json:"id,omitempty"`
-	TenantID       string            `json:"tenantId,omitempty"`
-	ClientID       string            `json:"clientId,omitempty"`
-	SubscriptionID string            `json:"subscriptionId,omitempty"`
-	HashNS         string            `json:"hashNS,omitempty"`
-	Variables      map[string]string `json:"variables,omitempty"`
-	Storage        StorageConfig     `json:"storage,omitempty"`
-	Identity       IdentityConfig    `json:"identity,omitempty"`
-	Machine        MachineConfig     `json:"machine,omitempty"`
-	Image          ImageConfig       `json:"image,omitempty"`
-	Gallery        GalleryConfig     `json:"gallery,omitempty"`
-	Builder        BuilderConfig     `json:"builder,omitempty"`
+	ID             string              `json:"id,omitempty"`
+	TenantID       string              `json:"tenantId,omitempty"`
+	ClientID       string              `json:"clientId,omitempty"`
+	SubscriptionID string              `json:"subscriptionId,omitempty"`
+	HashNS         string              `json:"hashNS,omitempty"`
+	Variables      map[string]string   `json:"variables,omitempty"`
+	Matrix         map[string][]string `json:"matrix,omitempty"`
+	Tags           map[string]string   `json:"tags,omitempty"`
+	Storage        StorageConfig       `json:"storage,omitempty"`
+	Identity       IdentityConfig      `json:"identity,omitempty"`
+	Machine        MachineConfig       `json:"machine,omitempty"`
+	Image          ImageConfig         `json:"image,omitempty"`
+	Gallery        GalleryConfig       `json:"gallery,omitempty"`
+	VHD            VHDConfig           `json:"vhd,omitempty"`
+	VNet           VNetConfig          `json:"vnet,omitempty"`
+	Builder        BuilderConfig       `json:"builder,omitempty"`
 }
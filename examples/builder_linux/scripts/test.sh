@@ -0,0 +1,7 @@
+#!/bin/bash
+
+set -ex
+
+cat /etc/os-release
+gcc --version
+make --version
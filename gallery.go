@@ -2,11 +2,18 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
 
+	"github.com/yaegashi/customazed/utils/azutil"
 	"github.com/yaegashi/customazed/utils/ssutil"
+	"github.com/yaegashi/customazed/utils/verutil"
 
 	"github.com/Azure/azure-sdk-for-go/profiles/2020-09-01/resources/mgmt/resources"
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-03-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
 )
 
 func (app *App) Gallery(ctx context.Context) (*compute.Gallery, error) {
@@ -62,6 +69,10 @@ func (app *App) GalleryGet(ctx context.Context) error {
 		return err
 	}
 
+	for _, d := range GalleryImageDrifts(galleryImage.GalleryImageProperties, app.GalleryImageProperties()) {
+		app.Logf("Gallery: drift detected: %s", d)
+	}
+
 	app._Gallery = &gallery
 	app._GalleryImage = &galleryImage
 
@@ -71,6 +82,204 @@ func (app *App) GalleryGet(ctx context.Context) error {
 	return nil
 }
 
+// GalleryImageProperties returns gallery image definition properties from configuration
+func (app *App) GalleryImageProperties() *compute.GalleryImageProperties {
+	cfg := app.Config.Gallery
+	props := &compute.GalleryImageProperties{
+		Identifier: &compute.GalleryImageIdentifier{
+			Publisher: to.StringPtr(cfg.Publisher),
+			Offer:     to.StringPtr(cfg.Offer),
+			Sku:       to.StringPtr(cfg.SKU),
+		},
+		OsState:          compute.OperatingSystemStateTypes(cfg.OSState),
+		OsType:           compute.OperatingSystemTypes(cfg.OSType),
+		HyperVGeneration: compute.HyperVGeneration(cfg.HyperVGeneration),
+	}
+	if cfg.Description != "" {
+		props.Description = to.StringPtr(cfg.Description)
+	}
+	if cfg.Eula != "" {
+		props.Eula = to.StringPtr(cfg.Eula)
+	}
+	if cfg.ReleaseNoteURI != "" {
+		props.ReleaseNoteURI = to.StringPtr(cfg.ReleaseNoteURI)
+	}
+	if len(cfg.Features) > 0 {
+		var names []string
+		for name := range cfg.Features {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var features []compute.GalleryImageFeature
+		for _, name := range names {
+			features = append(features, compute.GalleryImageFeature{
+				Name:  to.StringPtr(name),
+				Value: to.StringPtr(cfg.Features[name]),
+			})
+		}
+		props.Features = &features
+	}
+	resourceRange := func(r ResourceRangeConfig) *compute.ResourceRange {
+		if r.Min == 0 && r.Max == 0 {
+			return nil
+		}
+		rr := &compute.ResourceRange{}
+		if r.Min != 0 {
+			rr.Min = to.Int32Ptr(r.Min)
+		}
+		if r.Max != 0 {
+			rr.Max = to.Int32Ptr(r.Max)
+		}
+		return rr
+	}
+	vCPUs, memory := resourceRange(cfg.Recommended.VCPUs), resourceRange(cfg.Recommended.Memory)
+	if vCPUs != nil || memory != nil {
+		props.Recommended = &compute.RecommendedMachineConfiguration{VCPUs: vCPUs, Memory: memory}
+	}
+	if cfg.PurchasePlan != (GalleryPurchasePlanConfig{}) {
+		props.PurchasePlan = &compute.ImagePurchasePlan{
+			Name:      to.StringPtr(cfg.PurchasePlan.Name),
+			Publisher: to.StringPtr(cfg.PurchasePlan.Publisher),
+			Product:   to.StringPtr(cfg.PurchasePlan.Product),
+		}
+	}
+	return props
+}
+
+// GalleryReplicationRegionNames returns names of configured replication regions
+func (app *App) GalleryReplicationRegionNames() []string {
+	names := []string{}
+	for _, r := range app.Config.Gallery.ReplicationRegions {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// GalleryTargetRegions returns target regions for gallery image version publishing profile.
+// Per-region settings are taken from configuration, and the source location is always included.
+func (app *App) GalleryTargetRegions(location string, names []string) []compute.TargetRegion {
+	regions := map[string]GalleryRegionConfig{}
+	for _, r := range app.Config.Gallery.ReplicationRegions {
+		regions[strings.ToLower(r.Name)] = r
+	}
+	found := false
+	for _, name := range names {
+		if strings.EqualFold(name, location) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		names = append([]string{location}, names...)
+	}
+	var targetRegions []compute.TargetRegion
+	for _, name := range names {
+		targetRegion := compute.TargetRegion{Name: to.StringPtr(name)}
+		if r, ok := regions[strings.ToLower(name)]; ok {
+			if r.ReplicaCount > 0 {
+				targetRegion.RegionalReplicaCount = to.Int32Ptr(r.ReplicaCount)
+			}
+			targetRegion.StorageAccountType = compute.StorageAccountType(r.StorageAccountType)
+		}
+		targetRegions = append(targetRegions, targetRegion)
+	}
+	return targetRegions
+}
+
+// GalleryImageDrift describes a difference between existing and desired gallery image definitions
+type GalleryImageDrift struct {
+	Name      string
+	Existing  string
+	Desired   string
+	Immutable bool
+}
+
+func (d GalleryImageDrift) String() string {
+	s := fmt.Sprintf("%s: existing %q, config %q", d.Name, d.Existing, d.Desired)
+	if d.Immutable {
+		s += " (immutable)"
+	}
+	return s
+}
+
+// GalleryImageDrifts compares gallery image definitions and returns differences.
+// Properties missing in desired are not compared.
+func GalleryImageDrifts(existing, desired *compute.GalleryImageProperties) []GalleryImageDrift {
+	if existing == nil {
+		existing = &compute.GalleryImageProperties{}
+	}
+	if desired == nil {
+		desired = &compute.GalleryImageProperties{}
+	}
+	var drifts []GalleryImageDrift
+	compare := func(name, e, d string, immutable bool) {
+		if d != "" && !strings.EqualFold(e, d) {
+			drifts = append(drifts, GalleryImageDrift{Name: name, Existing: e, Desired: d, Immutable: immutable})
+		}
+	}
+	compareInt32 := func(name string, e, d *int32) {
+		if d != nil && (e == nil || *e != *d) {
+			es := ""
+			if e != nil {
+				es = fmt.Sprint(*e)
+			}
+			drifts = append(drifts, GalleryImageDrift{Name: name, Existing: es, Desired: fmt.Sprint(*d)})
+		}
+	}
+	compareRange := func(name string, e, d *compute.ResourceRange) {
+		if d == nil {
+			return
+		}
+		if e == nil {
+			e = &compute.ResourceRange{}
+		}
+		compareInt32(name+".min", e.Min, d.Min)
+		compareInt32(name+".max", e.Max, d.Max)
+	}
+
+	if existing.Identifier == nil {
+		existing.Identifier = &compute.GalleryImageIdentifier{}
+	}
+	if desired.Identifier != nil {
+		compare("identifier.publisher", to.String(existing.Identifier.Publisher), to.String(desired.Identifier.Publisher), true)
+		compare("identifier.offer", to.String(existing.Identifier.Offer), to.String(desired.Identifier.Offer), true)
+		compare("identifier.sku", to.String(existing.Identifier.Sku), to.String(desired.Identifier.Sku), true)
+	}
+	compare("osState", string(existing.OsState), string(desired.OsState), true)
+	compare("osType", string(existing.OsType), string(desired.OsType), true)
+	compare("hyperVGeneration", string(existing.HyperVGeneration), string(desired.HyperVGeneration), true)
+	if desired.Features != nil {
+		features := map[string]string{}
+		if existing.Features != nil {
+			for _, f := range *existing.Features {
+				features[strings.ToLower(to.String(f.Name))] = to.String(f.Value)
+			}
+		}
+		for _, f := range *desired.Features {
+			compare("features."+to.String(f.Name), features[strings.ToLower(to.String(f.Name))], to.String(f.Value), true)
+		}
+	}
+	if desired.PurchasePlan != nil {
+		if existing.PurchasePlan == nil {
+			existing.PurchasePlan = &compute.ImagePurchasePlan{}
+		}
+		compare("purchasePlan.name", to.String(existing.PurchasePlan.Name), to.String(desired.PurchasePlan.Name), true)
+		compare("purchasePlan.publisher", to.String(existing.PurchasePlan.Publisher), to.String(desired.PurchasePlan.Publisher), true)
+		compare("purchasePlan.product", to.String(existing.PurchasePlan.Product), to.String(desired.PurchasePlan.Product), true)
+	}
+	compare("description", to.String(existing.Description), to.String(desired.Description), false)
+	compare("eula", to.String(existing.Eula), to.String(desired.Eula), false)
+	compare("releaseNoteUri", to.String(existing.ReleaseNoteURI), to.String(desired.ReleaseNoteURI), false)
+	if desired.Recommended != nil {
+		if existing.Recommended == nil {
+			existing.Recommended = &compute.RecommendedMachineConfiguration{}
+		}
+		compareRange("recommended.vCPUs", existing.Recommended.VCPUs, desired.Recommended.VCPUs)
+		compareRange("recommended.memory", existing.Recommended.Memory, desired.Recommended.Memory)
+	}
+	return drifts
+}
+
 func (app *App) GallerySetup(ctx context.Context) error {
 	if !app.GalleryValid() {
 		return nil
@@ -89,8 +298,13 @@ func (app *App) GallerySetup(ctx context.Context) error {
 	app.Logf("Gallery: creating resource group: %s", app.Config.Gallery.ResourceGroup)
 	groupsClient := resources.NewGroupsClient(app.Config.SubscriptionID)
 	groupsClient.Authorizer = authorizer
+	groupTags, err := app.GroupTags(ctx, groupsClient, app.Config.Gallery.ResourceGroup, app.Config.Gallery.Tags)
+	if err != nil {
+		return err
+	}
 	group := resources.Group{
 		Location: &app.Config.Gallery.Location,
+		Tags:     groupTags,
 	}
 	_, err = groupsClient.CreateOrUpdate(ctx, app.Config.Gallery.ResourceGroup, group)
 	if err != nil {
@@ -100,8 +314,14 @@ func (app *App) GallerySetup(ctx context.Context) error {
 	app.Logf("Gallery: creating gallery: %s", app.Config.Gallery.GalleryName)
 	galleriesClient := compute.NewGalleriesClient(app.Config.SubscriptionID)
 	galleriesClient.Authorizer = authorizer
-	gallery := compute.Gallery{
+	gallery, err := galleriesClient.Get(ctx, app.Config.Gallery.ResourceGroup, app.Config.Gallery.GalleryName, "")
+	galleryTags, err := ExistingTags(gallery.Tags, err)
+	if err != nil {
+		return err
+	}
+	gallery = compute.Gallery{
 		Location: &app.Config.Gallery.Location,
+		Tags:     MergeTags(galleryTags, app.Tags(app.Config.Gallery.Tags)),
 	}
 	galleryFuture, err := galleriesClient.CreateOrUpdate(ctx, app.Config.Gallery.ResourceGroup, app.Config.Gallery.GalleryName, gallery)
 	if err != nil {
@@ -112,21 +332,29 @@ func (app *App) GallerySetup(ctx context.Context) error {
 		return err
 	}
 
-	app.Logf("Gallery: creating gallery image: %s", app.Config.Gallery.GalleryImageName)
 	galleryImagesClient := compute.NewGalleryImagesClient(app.Config.SubscriptionID)
 	galleryImagesClient.Authorizer = authorizer
 	galleryImage := compute.GalleryImage{
-		Location: &app.Config.Gallery.Location,
-		GalleryImageProperties: &compute.GalleryImageProperties{
-			Identifier: &compute.GalleryImageIdentifier{
-				Publisher: &app.Config.Gallery.Publisher,
-				Offer:     &app.Config.Gallery.Offer,
-				Sku:       &app.Config.Gallery.SKU,
-			},
-			OsState: compute.OperatingSystemStateTypes(app.Config.Gallery.OSState),
-			OsType:  compute.OperatingSystemTypes(app.Config.Gallery.OSType),
-		},
+		Location:               &app.Config.Gallery.Location,
+		GalleryImageProperties: app.GalleryImageProperties(),
+		Tags:                   app.Tags(app.Config.Gallery.Tags),
+	}
+	existing, err := galleryImagesClient.Get(ctx, app.Config.Gallery.ResourceGroup, app.Config.Gallery.GalleryName, app.Config.Gallery.GalleryImageName)
+	if err == nil {
+		galleryImage.Tags = MergeTags(existing.Tags, galleryImage.Tags)
+		immutable := false
+		for _, d := range GalleryImageDrifts(existing.GalleryImageProperties, galleryImage.GalleryImageProperties) {
+			app.Logf("Gallery: drift detected: %s", d)
+			immutable = immutable || d.Immutable
+		}
+		if immutable {
+			return fmt.Errorf("gallery image %s differs in immutable properties: use another gallery image name", app.Config.Gallery.GalleryImageName)
+		}
+	} else if aErr := azutil.Error(err); aErr == nil || aErr.StatusCode != http.StatusNotFound {
+		return err
 	}
+
+	app.Logf("Gallery: creating gallery image: %s", app.Config.Gallery.GalleryImageName)
 	galleryImageFuture, err := galleryImagesClient.CreateOrUpdate(ctx, app.Config.Gallery.ResourceGroup, app.Config.Gallery.GalleryName, app.Config.Gallery.GalleryImageName, galleryImage)
 	if err != nil {
 		return err
@@ -143,3 +371,97 @@ func (app *App) GallerySetup(ctx context.Context) error {
 
 	return nil
 }
+
+// GalleryImageVersions returns versions of the gallery image sorted by verutil.Compare (oldest first)
+func (app *App) GalleryImageVersions(ctx context.Context) ([]compute.GalleryImageVersion, error) {
+	galleryImage, err := app.GalleryImage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if galleryImage == nil {
+		return nil, fmt.Errorf("gallery image not configured")
+	}
+
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return nil, err
+	}
+
+	versionsClient := compute.NewGalleryImageVersionsClient(app.Config.SubscriptionID)
+	versionsClient.Authorizer = authorizer
+	result, err := versionsClient.ListByGalleryImageComplete(ctx, app.Config.Gallery.ResourceGroup, app.Config.Gallery.GalleryName, app.Config.Gallery.GalleryImageName)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []compute.GalleryImageVersion
+	for result.NotDone() {
+		versions = append(versions, result.Value())
+		err := result.NextWithContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Sort versions by version number (oldest first)
+	sort.SliceStable(versions, func(i, j int) bool {
+		return verutil.Compare(to.String(versions[i].Name), to.String(versions[j].Name)) < 0
+	})
+
+	return versions, nil
+}
+
+// GallerySourcePrefix is prefix of gallery image source shorthand "gallery:<rg>/<gallery>/<image>@<version>"
+const GallerySourcePrefix = "gallery:"
+
+// GallerySourceVersion returns the latest gallery image version matching source shorthand
+func (app *App) GallerySourceVersion(ctx context.Context, source string) (*compute.GalleryImageVersion, error) {
+	spec := strings.TrimPrefix(source, GallerySourcePrefix)
+	constraint := "latest"
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		spec, constraint = spec[:i], spec[i+1:]
+	}
+	names := strings.Split(spec, "/")
+	if len(names) != 3 || ssutil.HasEmpty(names...) {
+		return nil, fmt.Errorf("invalid gallery source %q: expected %s<rg>/<gallery>/<image>@<version>", source, GallerySourcePrefix)
+	}
+
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return nil, err
+	}
+
+	versionsClient := compute.NewGalleryImageVersionsClient(app.Config.SubscriptionID)
+	versionsClient.Authorizer = authorizer
+	result, err := versionsClient.ListByGalleryImageComplete(ctx, names[0], names[1], names[2])
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *compute.GalleryImageVersion
+	for result.NotDone() {
+		v := result.Value()
+		ok := v.Name != nil && v.GalleryImageVersionProperties != nil && v.ProvisioningState == compute.ProvisioningState3Succeeded
+		if ok && constraint == "latest" {
+			pp := v.PublishingProfile
+			ok = pp == nil || pp.ExcludeFromLatest == nil || !*pp.ExcludeFromLatest
+		}
+		if ok {
+			ok, err = verutil.Match(*v.Name, constraint)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if ok && (latest == nil || verutil.Compare(*v.Name, *latest.Name) > 0) {
+			latest = &v
+		}
+		err := result.NextWithContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no gallery image version matching %q in %s", constraint, spec)
+	}
+	return latest, nil
+}
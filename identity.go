@@ -64,8 +64,13 @@ func (app *App) IdentitySetup(ctx context.Context) error {
 	app.Logf("Identity: creating resource group: %s", app.Config.Identity.ResourceGroup)
 	groupsClient := resources.NewGroupsClient(app.Config.SubscriptionID)
 	groupsClient.Authorizer = authorizer
+	groupTags, err := app.GroupTags(ctx, groupsClient, app.Config.Identity.ResourceGroup, app.Config.Identity.Tags)
+	if err != nil {
+		return err
+	}
 	groupsParams := resources.Group{
 		Location: &app.Config.Identity.Location,
+		Tags:     groupTags,
 	}
 	_, err = groupsClient.CreateOrUpdate(ctx, app.Config.Identity.ResourceGroup, groupsParams)
 	if err != nil {
@@ -75,8 +80,14 @@ func (app *App) IdentitySetup(ctx context.Context) error {
 	app.Logf("Identity: creating user assigned identity: %s", app.Config.Identity.IdentityName)
 	msiClient := msi.NewUserAssignedIdentitiesClient(app.Config.SubscriptionID)
 	msiClient.Authorizer = authorizer
+	identity, err := msiClient.Get(ctx, app.Config.Identity.ResourceGroup, app.Config.Identity.IdentityName)
+	identityTags, err := ExistingTags(identity.Tags, err)
+	if err != nil {
+		return err
+	}
 	identityParams := msi.Identity{
 		Location: &app.Config.Identity.Location,
+		Tags:     MergeTags(identityTags, app.Tags(app.Config.Identity.Tags)),
 	}
 	_, err = msiClient.CreateOrUpdate(ctx, app.Config.Identity.ResourceGroup, app.Config.Identity.IdentityName, identityParams)
 	if err != nil {
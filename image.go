@@ -58,8 +58,13 @@ func (app *App) ImageSetup(ctx context.Context) error {
 	app.Logf("Image: creating resource group: %s", app.Config.Image.ResourceGroup)
 	groupsClient := resources.NewGroupsClient(app.Config.SubscriptionID)
 	groupsClient.Authorizer = authorizer
+	groupTags, err := app.GroupTags(ctx, groupsClient, app.Config.Image.ResourceGroup, app.Config.Image.Tags)
+	if err != nil {
+		return err
+	}
 	groupsParams := resources.Group{
 		Location: &app.Config.Image.Location,
+		Tags:     groupTags,
 	}
 	_, err = groupsClient.CreateOrUpdate(ctx, app.Config.Image.ResourceGroup, groupsParams)
 	if err != nil {
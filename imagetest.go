@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yaegashi/customazed/utils/azutil"
+
+	"github.com/Azure/azure-sdk-for-go/profiles/2020-09-01/resources/mgmt/resources"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-03-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-03-01/network"
+	"github.com/Azure/azure-sdk-for-go/services/preview/authorization/mgmt/2018-09-01-preview/authorization"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/google/uuid"
+)
+
+const (
+	imageTestVMSize        = "Standard_D2s_v3"
+	imageTestMachineName   = "customazed"
+	imageTestAdminUsername = "customazed"
+	imageTestAddressPrefix = "10.0.0.0/24"
+	// Custom script extension retries while blob reader role assignment propagates
+	imageTestDownloadRetries = 6
+	imageTestDownloadDelay   = 30 * time.Second
+)
+
+// ImageTestImage is managed image or gallery image version to boot a test VM from
+type ImageTestImage struct {
+	ID          string
+	Location    string
+	Regions     []string
+	OSType      compute.OperatingSystemTypes
+	Specialized bool
+	// HyperVGeneration is V1 or V2, empty if unknown
+	HyperVGeneration string
+	// SecurityType is gallery image feature SecurityType such as TrustedLaunch
+	SecurityType string
+}
+
+// DefaultLocation returns image location, or the first target region if the gallery image version is not replicated there
+func (image *ImageTestImage) DefaultLocation() string {
+	if len(image.Regions) == 0 || image.HasRegion(image.Location) {
+		return image.Location
+	}
+	return image.Regions[0]
+}
+
+// HasRegion reports whether the image is available in location
+func (image *ImageTestImage) HasRegion(location string) bool {
+	if len(image.Regions) == 0 {
+		return true
+	}
+	normalize := func(s string) string { return strings.ToLower(strings.ReplaceAll(s, " ", "")) }
+	for _, r := range image.Regions {
+		if normalize(r) == normalize(location) {
+			return true
+		}
+	}
+	return false
+}
+
+// ImageTestDefaultImage returns image of the current configuration
+func (app *App) ImageTestDefaultImage(ctx context.Context) (string, error) {
+	if app.ImageValid() && !app.Config.Image.SkipCreate {
+		err := app.ImageGet(ctx)
+		if err != nil {
+			return "", err
+		}
+		return app.Config.Image.ImageID, nil
+	}
+	if app.GalleryValid() {
+		cfg := app.Config.Gallery
+		return fmt.Sprintf("%s%s/%s/%s@latest", GallerySourcePrefix, cfg.ResourceGroup, cfg.GalleryName, cfg.GalleryImageName), nil
+	}
+	return "", fmt.Errorf("no image to test: specify --image or configure image or gallery")
+}
+
+// ImageTestGetImage returns managed image or gallery image version by resource ID or gallery source shorthand
+func (app *App) ImageTestGetImage(ctx context.Context, image string) (*ImageTestImage, error) {
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(image, GallerySourcePrefix) {
+		version, err := app.GallerySourceVersion(ctx, image)
+		if err != nil {
+			return nil, err
+		}
+		image = *version.ID
+	}
+
+	id, err := azutil.ParseImageID(image)
+	if err != nil {
+		return nil, fmt.Errorf("%s: expected managed image ID, gallery image version ID or %s<rg>/<gallery>/<image>@<version>", err, GallerySourcePrefix)
+	}
+
+	if !id.IsGalleryImageVersion() {
+		imagesClient := compute.NewImagesClient(id.SubscriptionID)
+		imagesClient.Authorizer = authorizer
+		result, err := imagesClient.Get(ctx, id.ResourceGroup, id.ImageName, "")
+		if err != nil {
+			return nil, err
+		}
+		if result.ImageProperties == nil || result.StorageProfile == nil || result.StorageProfile.OsDisk == nil {
+			return nil, fmt.Errorf("managed image %s has no OS disk", image)
+		}
+		return &ImageTestImage{
+			ID:               *result.ID,
+			Location:         to.String(result.Location),
+			OSType:           result.StorageProfile.OsDisk.OsType,
+			Specialized:      result.StorageProfile.OsDisk.OsState == compute.OperatingSystemStateTypesSpecialized,
+			HyperVGeneration: string(result.HyperVGeneration),
+		}, nil
+	}
+
+	galleryImagesClient := compute.NewGalleryImagesClient(id.SubscriptionID)
+	galleryImagesClient.Authorizer = authorizer
+	galleryImage, err := galleryImagesClient.Get(ctx, id.ResourceGroup, id.GalleryName, id.GalleryImageName)
+	if err != nil {
+		return nil, err
+	}
+	if galleryImage.GalleryImageProperties == nil {
+		return nil, fmt.Errorf("gallery image %s has no properties", id.GalleryImageName)
+	}
+	versionsClient := compute.NewGalleryImageVersionsClient(id.SubscriptionID)
+	versionsClient.Authorizer = authorizer
+	version, err := versionsClient.Get(ctx, id.ResourceGroup, id.GalleryName, id.GalleryImageName, id.Version, "")
+	if err != nil {
+		return nil, err
+	}
+	result := &ImageTestImage{
+		ID:               *version.ID,
+		Location:         to.String(version.Location),
+		OSType:           galleryImage.OsType,
+		Specialized:      galleryImage.OsState == compute.OperatingSystemStateTypesSpecialized,
+		HyperVGeneration: string(galleryImage.HyperVGeneration),
+	}
+	if galleryImage.Features != nil {
+		for _, f := range *galleryImage.Features {
+			if strings.EqualFold(to.String(f.Name), "SecurityType") {
+				result.SecurityType = to.String(f.Value)
+			}
+		}
+	}
+	// Gallery image versions are available only in regions they are replicated to
+	if p := version.GalleryImageVersionProperties; p != nil && p.PublishingProfile != nil && p.PublishingProfile.TargetRegions != nil {
+		for _, r := range *p.PublishingProfile.TargetRegions {
+			if r.Name != nil {
+				result.Regions = append(result.Regions, *r.Name)
+			}
+		}
+	}
+	return result, nil
+}
+
+// ImageTestResourceGroupName returns random name for temporary resource group
+func ImageTestResourceGroupName() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return "customazed-test-" + hex.EncodeToString(b)
+}
+
+// imageTestPassword returns random admin password satisfying Azure complexity requirements
+func imageTestPassword() string {
+	b := make([]byte, 18)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b) + "Aa1!"
+}
+
+// ImageTestCheckGroup returns error if temporary resource group already exists
+func (app *App) ImageTestCheckGroup(ctx context.Context, groupName string) error {
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	groupsClient := resources.NewGroupsClient(app.Config.SubscriptionID)
+	groupsClient.Authorizer = authorizer
+	result, err := groupsClient.CheckExistence(ctx, groupName)
+	if err != nil {
+		return err
+	}
+	if result.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("resource group %s already exists: test VM requires a new resource group to delete after test", groupName)
+	}
+	return nil
+}
+
+// ImageTestCreateGroup creates temporary resource group, refusing to reuse an existing one
+func (app *App) ImageTestCreateGroup(ctx context.Context, groupName, location string) error {
+	err := app.ImageTestCheckGroup(ctx, groupName)
+	if err != nil {
+		return err
+	}
+
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	groupsClient := resources.NewGroupsClient(app.Config.SubscriptionID)
+	groupsClient.Authorizer = authorizer
+	app.Logf("Image test: creating resource group: %s", groupName)
+	groupsParams := resources.Group{
+		Location: &location,
+		Tags:     app.Tags(nil),
+	}
+	_, err = groupsClient.CreateOrUpdate(ctx, groupName, groupsParams)
+	return err
+}
+
+// ImageTestCreateMachine creates network and VM booted from image in temporary resource group
+func (app *App) ImageTestCreateMachine(ctx context.Context, groupName, location, size string, image *ImageTestImage) (*compute.VirtualMachine, error) {
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return nil, err
+	}
+
+	app.Logf("Image test: creating virtual network: %s", imageTestMachineName)
+	vnetsClient := network.NewVirtualNetworksClient(app.Config.SubscriptionID)
+	vnetsClient.Authorizer = authorizer
+	vnetParams := network.VirtualNetwork{
+		Location: &location,
+		Tags:     app.Tags(nil),
+		VirtualNetworkPropertiesFormat: &network.VirtualNetworkPropertiesFormat{
+			AddressSpace: &network.AddressSpace{AddressPrefixes: &[]string{imageTestAddressPrefix}},
+			Subnets: &[]network.Subnet{{
+				Name:                   to.StringPtr(imageTestMachineName),
+				SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: to.StringPtr(imageTestAddressPrefix)},
+			}},
+		},
+	}
+	vnetFuture, err := vnetsClient.CreateOrUpdate(ctx, groupName, imageTestMachineName, vnetParams)
+	if err != nil {
+		return nil, err
+	}
+	err = vnetFuture.WaitForCompletionRef(ctx, vnetsClient.Client)
+	if err != nil {
+		return nil, err
+	}
+	vnet, err := vnetFuture.Result(vnetsClient)
+	if err != nil {
+		return nil, err
+	}
+
+	// Network interface without public IP address
+	app.Logf("Image test: creating network interface: %s", imageTestMachineName)
+	interfacesClient := network.NewInterfacesClient(app.Config.SubscriptionID)
+	interfacesClient.Authorizer = authorizer
+	interfaceParams := network.Interface{
+		Location: &location,
+		Tags:     app.Tags(nil),
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			IPConfigurations: &[]network.InterfaceIPConfiguration{{
+				Name: to.StringPtr(imageTestMachineName),
+				InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+					Subnet:                    &(*vnet.Subnets)[0],
+					PrivateIPAllocationMethod: network.IPAllocationMethodDynamic,
+				},
+			}},
+		},
+	}
+	interfaceFuture, err := interfacesClient.CreateOrUpdate(ctx, groupName, imageTestMachineName, interfaceParams)
+	if err != nil {
+		return nil, err
+	}
+	err = interfaceFuture.WaitForCompletionRef(ctx, interfacesClient.Client)
+	if err != nil {
+		return nil, err
+	}
+	nic, err := interfaceFuture.Result(interfacesClient)
+	if err != nil {
+		return nil, err
+	}
+
+	app.Logf("Image test: creating virtual machine: %s (%s)", imageTestMachineName, size)
+	machinesClient := compute.NewVirtualMachinesClient(app.Config.SubscriptionID)
+	machinesClient.Authorizer = authorizer
+	machineParams := compute.VirtualMachine{
+		Location: &location,
+		Tags:     app.Tags(nil),
+		Identity: &compute.VirtualMachineIdentity{
+			Type: compute.ResourceIdentityTypeSystemAssigned,
+		},
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			HardwareProfile: &compute.HardwareProfile{
+				VMSize: compute.VirtualMachineSizeTypes(size),
+			},
+			StorageProfile: &compute.StorageProfile{
+				ImageReference: &compute.ImageReference{ID: &image.ID},
+				OsDisk: &compute.OSDisk{
+					CreateOption: compute.DiskCreateOptionTypesFromImage,
+					ManagedDisk: &compute.ManagedDiskParameters{
+						StorageAccountType: compute.StorageAccountTypesStandardSSDLRS,
+					},
+				},
+			},
+			NetworkProfile: &compute.NetworkProfile{
+				NetworkInterfaces: &[]compute.NetworkInterfaceReference{{
+					ID: nic.ID,
+					NetworkInterfaceReferenceProperties: &compute.NetworkInterfaceReferenceProperties{
+						Primary: to.BoolPtr(true),
+					},
+				}},
+			},
+		},
+	}
+	// Trusted launch images boot only with secure boot and vTPM enabled
+	if strings.EqualFold(image.SecurityType, string(compute.SecurityTypesTrustedLaunch)) {
+		machineParams.SecurityProfile = &compute.SecurityProfile{
+			SecurityType: compute.SecurityTypesTrustedLaunch,
+			UefiSettings: &compute.UefiSettings{
+				SecureBootEnabled: to.BoolPtr(true),
+				VTpmEnabled:       to.BoolPtr(true),
+			},
+		}
+	}
+	// Specialized images keep their own computer name and accounts
+	if !image.Specialized {
+		machineParams.OsProfile = &compute.OSProfile{
+			ComputerName:  to.StringPtr(imageTestMachineName),
+			AdminUsername: to.StringPtr(imageTestAdminUsername),
+			AdminPassword: to.StringPtr(imageTestPassword()),
+		}
+		if image.OSType == compute.OperatingSystemTypesLinux {
+			machineParams.OsProfile.LinuxConfiguration = &compute.LinuxConfiguration{
+				DisablePasswordAuthentication: to.BoolPtr(false),
+			}
+		}
+	}
+	machineFuture, err := machinesClient.CreateOrUpdate(ctx, groupName, imageTestMachineName, machineParams)
+	if err != nil {
+		return nil, err
+	}
+	err = machineFuture.WaitForCompletionRef(ctx, machinesClient.Client)
+	if err != nil {
+		return nil, err
+	}
+	machine, err := machineFuture.Result(machinesClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return &machine, nil
+}
+
+// ImageTestAssignRole assigns blob reader role on storage container to test VM and returns the role assignment ID
+func (app *App) ImageTestAssignRole(ctx context.Context, machine *compute.VirtualMachine) (string, error) {
+	container, err := app.StorageContainer(ctx)
+	if err != nil || container == nil {
+		return "", err
+	}
+	if machine.Identity == nil || machine.Identity.PrincipalID == nil {
+		return "", fmt.Errorf("virtual machine %s has no system assigned identity", *machine.Name)
+	}
+
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return "", err
+	}
+
+	app.Logf("Image test: assign role to machine for blob container")
+	roleAssignmentsClient := authorization.NewRoleAssignmentsClient(app.Config.SubscriptionID)
+	roleAssignmentsClient.Authorizer = authorizer
+	roleAssignmentParams := authorization.RoleAssignmentCreateParameters{
+		RoleAssignmentProperties: &authorization.RoleAssignmentProperties{
+			RoleDefinitionID: to.StringPtr(fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Authorization/roleDefinitions/%s", app.Config.SubscriptionID, RoleNameStorageBlobDataReader)),
+			PrincipalID:      machine.Identity.PrincipalID,
+		},
+	}
+	// Role assignment ID is known in advance so that cleanup works even if creation is interrupted
+	name := uuid.New().String()
+	roleAssignmentID := fmt.Sprintf("%s/providers/Microsoft.Authorization/roleAssignments/%s", *container.ID, name)
+	// New principal takes a while to be replicated
+	for i := 0; ; i++ {
+		_, err := roleAssignmentsClient.Create(ctx, *container.ID, name, roleAssignmentParams)
+		if err == nil {
+			return roleAssignmentID, nil
+		}
+		if aErr := azutil.Error(err); aErr == nil || aErr.ServiceError.Code != "PrincipalNotFound" || i >= 12 {
+			return roleAssignmentID, err
+		}
+		select {
+		case <-ctx.Done():
+			return roleAssignmentID, ctx.Err()
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+// ImageTestDownloadForbidden reports whether custom script extension failed to download files with 403
+func ImageTestDownloadForbidden(extension *compute.VirtualMachineExtension) bool {
+	if extension.VirtualMachineExtensionProperties == nil || extension.InstanceView == nil {
+		return false
+	}
+	statuses := []compute.InstanceViewStatus{}
+	if extension.InstanceView.Statuses != nil {
+		statuses = append(statuses, *extension.InstanceView.Statuses...)
+	}
+	if extension.InstanceView.Substatuses != nil {
+		statuses = append(statuses, *extension.InstanceView.Substatuses...)
+	}
+	for _, status := range statuses {
+		msg := strings.ToLower(to.String(status.Message))
+		if strings.Contains(msg, "download") && (strings.Contains(msg, "403") || strings.Contains(msg, "authorizationpermissionmismatch")) {
+			return true
+		}
+	}
+	return false
+}
+
+// ImageTestCleanup deletes role assignment and temporary resource group
+func (app *App) ImageTestCleanup(ctx context.Context, groupName, roleAssignmentID string) error {
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	if roleAssignmentID != "" {
+		app.Logf("Image test: deleting role assignment: %s", roleAssignmentID)
+		roleAssignmentsClient := authorization.NewRoleAssignmentsClient(app.Config.SubscriptionID)
+		roleAssignmentsClient.Authorizer = authorizer
+		_, err = roleAssignmentsClient.DeleteByID(ctx, roleAssignmentID)
+		if err != nil {
+			app.Logf("Warning: %s", err)
+		}
+	}
+
+	app.Logf("Image test: deleting resource group: %s", groupName)
+	groupsClient := resources.NewGroupsClient(app.Config.SubscriptionID)
+	groupsClient.Authorizer = authorizer
+	groupFuture, err := groupsClient.Delete(ctx, groupName)
+	if err != nil {
+		return err
+	}
+	return groupFuture.WaitForCompletionRef(ctx, groupsClient.Client)
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/yaegashi/customazed/utils/ssutil"
 
@@ -33,6 +36,69 @@ func NewLinuxCustomScriptExtension(location string) *compute.VirtualMachineExten
 	}
 }
 
+// CustomScriptSettings is input object of app machine run
+type CustomScriptSettings struct {
+	FileUris         []string `json:"fileUris,omitempty"`
+	CommandToExecute string   `json:"commandToExecute,omitempty"`
+	SkipDos2Unix     bool     `json:"skipDos2Unix,omitempty"`
+	Timestamp        int      `json:"timestamp,omitempty"`
+}
+
+// NewCustomScriptExtensionWithSettings returns custom script extension for the OS type with settings
+func NewCustomScriptExtensionWithSettings(location string, osType compute.OperatingSystemTypes, settings *CustomScriptSettings) (*compute.VirtualMachineExtension, error) {
+	var extensionParams *compute.VirtualMachineExtension
+	switch osType {
+	case compute.OperatingSystemTypesWindows:
+		extensionParams = NewWindowsCustomScriptExtension(location)
+		extensionParams.ProtectedSettings = map[string]interface{}{
+			"fileUris":         settings.FileUris,
+			"commandToExecute": settings.CommandToExecute,
+			"timestamp":        settings.Timestamp,
+			"managedIdentity":  map[string]string{},
+		}
+	case compute.OperatingSystemTypesLinux:
+		extensionParams = NewLinuxCustomScriptExtension(location)
+		extensionParams.Settings = map[string]interface{}{
+			"skipDos2Unix": settings.SkipDos2Unix,
+			"timestamp":    settings.Timestamp,
+		}
+		extensionParams.ProtectedSettings = map[string]interface{}{
+			"fileUris":         settings.FileUris,
+			"commandToExecute": settings.CommandToExecute,
+			"managedIdentity":  map[string]string{},
+		}
+	default:
+		return nil, fmt.Errorf("VM has unknown OS type: %s", osType)
+	}
+	return extensionParams, nil
+}
+
+// LogExtensionStatus logs statuses and script output in extension instance view
+func (app *App) LogExtensionStatus(extension *compute.VirtualMachineExtension) error {
+	if extension.VirtualMachineExtensionProperties == nil || extension.VirtualMachineExtensionProperties.InstanceView == nil {
+		return errors.New("missing extension instance view (maybe virtual machine is not running)")
+	}
+	instanceView := extension.VirtualMachineExtensionProperties.InstanceView
+	if instanceView.Statuses != nil {
+		for _, status := range *instanceView.Statuses {
+			app.Logf("%s: %s\n%s", to.String(status.Code), to.String(status.DisplayStatus), to.String(status.Message))
+		}
+	}
+	if instanceView.Substatuses != nil {
+		for _, status := range *instanceView.Substatuses {
+			code := strings.Split(to.String(status.Code), "/")
+			if len(code) == 3 && code[0] == "ComponentStatus" {
+				msg := to.String(status.Message)
+				if len(msg) > 0 && msg[len(msg)-1] != '\n' {
+					msg = msg + "\n"
+				}
+				app.Logf("%s:\n%s", code[1], msg)
+			}
+		}
+	}
+	return nil
+}
+
 func (app *App) Machine(ctx context.Context) (*compute.VirtualMachine, error) {
 	if app._Machine == nil {
 		err := app.MachineGet(ctx)
@@ -1,16 +1,30 @@
 package main
 
 import (
+	"errors"
 	"os"
 
 	cmder "github.com/yaegashi/cobra-cmder"
 )
 
+// ExitError is error with process exit code
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string { return e.Err.Error() }
+func (e *ExitError) Unwrap() error { return e.Err }
+
 func main() {
 	app := &App{}
 	cmd := cmder.Cmd(app)
 	err := cmd.Execute()
 	if err != nil {
+		var eErr *ExitError
+		if errors.As(err, &eErr) {
+			os.Exit(eErr.Code)
+		}
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/virtualmachineimagebuilder/mgmt/2020-02-14/virtualmachineimagebuilder"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// BuildManifest records inputs and outputs of an image build
+type BuildManifest struct {
+	ConfigID     string              `json:"configId,omitempty"`
+	HashNS       string              `json:"hashNS"`
+	BuilderName  string              `json:"builderName"`
+	CreatedAt    string              `json:"createdAt"`
+	UpdatedAt    string              `json:"updatedAt"`
+	Source       string              `json:"source"`
+	Distribute   []string            `json:"distribute"`
+	Uploads      []ManifestUpload    `json:"uploads"`
+	Template     json.RawMessage     `json:"template"`
+	RunState     string              `json:"runState,omitempty"`
+	RunStartTime string              `json:"runStartTime,omitempty"`
+	RunEndTime   string              `json:"runEndTime,omitempty"`
+	RunOutputs   []ManifestRunOutput `json:"runOutputs,omitempty"`
+}
+
+// ManifestUpload is a file uploaded for an image build
+type ManifestUpload struct {
+	Path    string `json:"path"`
+	SHA256  string `json:"sha256"`
+	BlobURL string `json:"blobUrl"`
+}
+
+// ManifestRunOutput is a run output of an image build
+type ManifestRunOutput struct {
+	Name        string `json:"name"`
+	ArtifactID  string `json:"artifactId,omitempty"`
+	ArtifactURI string `json:"artifactUri,omitempty"`
+}
+
+// ManifestName returns file name of the build manifest for the current builder
+func (app *App) ManifestName() string {
+	return fmt.Sprintf("manifest_%s.json", app.Config.Builder.BuilderName)
+}
+
+// NewBuildManifest returns build manifest for the resolved image template and uploaded files
+func (app *App) NewBuildManifest(template *virtualmachineimagebuilder.ImageTemplate, uploads map[string]string) (*BuildManifest, error) {
+	b, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	m := &BuildManifest{
+		ConfigID:    app.Config.ID,
+		HashNS:      app._HashNS.String(),
+		BuilderName: app.Config.Builder.BuilderName,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Source:      builderSourceString(template.Source),
+		Distribute:  []string{},
+		Uploads:     []ManifestUpload{},
+		Template:    b,
+	}
+	if template.Distribute != nil {
+		for _, d := range *template.Distribute {
+			m.Distribute = append(m.Distribute, builderDistributorString(d))
+		}
+	}
+	var paths []string
+	for p := range uploads {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		sum, err := fileSHA256(p)
+		if err != nil {
+			return nil, err
+		}
+		m.Uploads = append(m.Uploads, ManifestUpload{Path: p, SHA256: sum, BlobURL: uploads[p]})
+	}
+	return m, nil
+}
+
+// MarshalManifest returns JSON of the build manifest with its SHA-256 hash
+func MarshalManifest(m *BuildManifest) ([]byte, string, error) {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(b)
+	return b, hex.EncodeToString(sum[:]), nil
+}
+
+// WriteManifest writes the build manifest in the config dir and the blob container
+func (app *App) WriteManifest(ctx context.Context, b []byte) error {
+	name := app.ManifestName()
+	loc, _ := app.ConfigStore.Location(name, true)
+	app.Logf("Manifest: saving %s", loc)
+	err := app.ConfigStore.WriteFile(name, b, 0644)
+	if err != nil {
+		return err
+	}
+
+	blobURL, err := app.ManifestBlobURL(ctx)
+	if err != nil || blobURL == nil {
+		return err
+	}
+	app.Logf("Manifest: uploading %s", blobURL.String())
+	_, err = azblob.UploadBufferToBlockBlob(ctx, b, *blobURL, azblob.UploadToBlockBlobOptions{
+		BlobHTTPHeaders: azblob.BlobHTTPHeaders{ContentType: "application/json"},
+	})
+	return err
+}
+
+// ReadManifest reads the build manifest from the config dir, or the blob container if missing
+func (app *App) ReadManifest(ctx context.Context) (*BuildManifest, error) {
+	b, err := app.ConfigStore.ReadFile(app.ManifestName())
+	if err != nil {
+		blobURL, bErr := app.ManifestBlobURL(ctx)
+		if bErr != nil || blobURL == nil {
+			return nil, err
+		}
+		resp, bErr := blobURL.Download(ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+		if bErr != nil {
+			return nil, bErr
+		}
+		body := resp.Body(azblob.RetryReaderOptions{})
+		b, err = ioutil.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var m BuildManifest
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ManifestBlobURL returns blob URL of the build manifest next to the storage prefix (nil without storage)
+func (app *App) ManifestBlobURL(ctx context.Context) (*azblob.BlockBlobURL, error) {
+	if !app.StorageValid() || app.NoLogin {
+		return nil, nil
+	}
+	token, err := app.StorageToken()
+	if err != nil {
+		return nil, err
+	}
+	account, err := app.StorageAccount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p := azblob.NewPipeline(azblob.NewTokenCredential(token.OAuthToken(), nil), azblob.PipelineOptions{})
+	endpointURL, _ := url.Parse(*account.PrimaryEndpoints.Blob)
+	serviceURL := azblob.NewServiceURL(*endpointURL, p)
+	containerURL := serviceURL.NewContainerURL(app.Config.Storage.ContainerName)
+	blobURL := containerURL.NewBlockBlobURL(path.Join(app.Config.Storage.Prefix, app.ManifestName()))
+	return &blobURL, nil
+}
+
+// UpdateManifestRun records the last run status and run outputs in the build manifest
+func (app *App) UpdateManifestRun(ctx context.Context) error {
+	m, err := app.ReadManifest(ctx)
+	if err != nil {
+		return err
+	}
+
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	templatesClient := virtualmachineimagebuilder.NewVirtualMachineImageTemplatesClient(app.Config.SubscriptionID)
+	templatesClient.Authorizer = authorizer
+	template, err := templatesClient.Get(ctx, app.Config.Builder.ResourceGroup, app.Config.Builder.BuilderName)
+	if err != nil {
+		return err
+	}
+	if s := template.LastRunStatus; s != nil {
+		m.RunState = string(s.RunState)
+		if s.StartTime != nil {
+			m.RunStartTime = s.StartTime.Format(time.RFC3339)
+		}
+		if s.EndTime != nil && s.StartTime != nil && !s.EndTime.Before(s.StartTime.Time) {
+			m.RunEndTime = s.EndTime.Format(time.RFC3339)
+		}
+		if s.RunState == virtualmachineimagebuilder.RunStateSucceeded || s.RunState == virtualmachineimagebuilder.RunStatePartiallySucceeded {
+			m.RunOutputs = nil
+			result, err := templatesClient.ListRunOutputsComplete(ctx, app.Config.Builder.ResourceGroup, app.Config.Builder.BuilderName)
+			if err != nil {
+				return err
+			}
+			for result.NotDone() {
+				r := result.Value()
+				o := ManifestRunOutput{}
+				if r.Name != nil {
+					o.Name = *r.Name
+				}
+				if r.ArtifactID != nil {
+					o.ArtifactID = *r.ArtifactID
+				}
+				if r.ArtifactURI != nil {
+					o.ArtifactURI = *r.ArtifactURI
+				}
+				m.RunOutputs = append(m.RunOutputs, o)
+				err := result.NextWithContext(ctx)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	m.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	b, _, err := MarshalManifest(m)
+	if err != nil {
+		return err
+	}
+	return app.WriteManifest(ctx, b)
+}
+
+func fileSHA256(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/yaegashi/customazed/utils/reflectutil"
+)
+
+// MatrixCell is a combination of matrix variable values
+type MatrixCell struct {
+	Name      string
+	Variables map[string]string
+}
+
+// MatrixCells expands the matrix section into cells in the order of sorted keys
+func (cfg *Config) MatrixCells() []MatrixCell {
+	if len(cfg.Matrix) == 0 {
+		return nil
+	}
+	var keys []string
+	for k := range cfg.Matrix {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	cells := []MatrixCell{{Variables: map[string]string{}}}
+	for _, k := range keys {
+		var next []MatrixCell
+		for _, c := range cells {
+			for _, v := range cfg.Matrix[k] {
+				vars := map[string]string{k: v}
+				for ck, cv := range c.Variables {
+					vars[ck] = cv
+				}
+				next = append(next, MatrixCell{Variables: vars})
+			}
+		}
+		cells = next
+	}
+	for i := range cells {
+		var values []string
+		for _, k := range keys {
+			values = append(values, cells[i].Variables[k])
+		}
+		cells[i].Name = strings.Join(values, "-")
+	}
+	return cells
+}
+
+// MatrixCell returns the matrix cell with the name
+func (cfg *Config) MatrixCell(name string) (*MatrixCell, error) {
+	var names []string
+	for _, c := range cfg.MatrixCells() {
+		if c.Name == name {
+			return &c, nil
+		}
+		names = append(names, c.Name)
+	}
+	return nil, fmt.Errorf("matrix cell %q not found (available: %s)", name, strings.Join(names, ", "))
+}
+
+// MatrixApp returns a copy of app configured for the matrix cell
+func (app *App) MatrixApp(cell MatrixCell) (*App, error) {
+	cellApp := &App{
+		ConfigLoad:     app.ConfigLoad,
+		ConfigStore:    app.ConfigStore,
+		ConfigFile:     app.ConfigFile,
+		ConfigDir:      app.ConfigDir,
+		HashNS:         app.HashNS,
+		TenantID:       app.TenantID,
+		ClientID:       app.ClientID,
+		SubscriptionID: app.SubscriptionID,
+		Auth:           app.Auth,
+		AuthFile:       app.AuthFile,
+		AuthDev:        app.AuthDev,
+		Quiet:          app.Quiet,
+		NoLogin:        app.NoLogin,
+		NoPrompt:       app.NoPrompt,
+		BuilderInput:   app.BuilderInput,
+		LogPrefix:      fmt.Sprintf("[%s] ", cell.Name),
+		_ARMToken:      app._ARMToken,
+		_StorageToken:  app._StorageToken,
+	}
+	err := cellApp.ResolveConfig(&cell)
+	if err != nil {
+		return nil, err
+	}
+	// Keep the credentials obtained at login
+	cellApp.Config.TenantID = app.Config.TenantID
+	cellApp.Config.ClientID = app.Config.ClientID
+	cellApp.Config.SubscriptionID = app.Config.SubscriptionID
+	return cellApp, nil
+}
+
+// ResolveConfig resolves template variables in the loaded config for the matrix cell (nil for no matrix)
+func (app *App) ResolveConfig(cell *MatrixCell) error {
+	cfgLoad := reflectutil.Clone(app.ConfigLoad).(*Config)
+	if cell != nil {
+		if cfgLoad.Variables == nil {
+			cfgLoad.Variables = map[string]string{}
+		}
+		for k, v := range cell.Variables {
+			cfgLoad.Variables[k] = v
+		}
+	}
+	app.ConfigLoad = cfgLoad
+	app.MatrixCell = cell
+
+	tv := app.NewTemplateVariable(DisabledStorageUploader(fmt.Sprintf("upload: forbidden in %s", app.ConfigFile)))
+
+	hashNS, err := tv.Execute(app.ConfigLoad.HashNS)
+	if err != nil {
+		return err
+	}
+	app._HashNS = uuid.NewSHA1(initialHashNS, []byte(hashNS))
+
+	cfg := reflectutil.Clone(app.ConfigLoad)
+	err = tv.Resolve(cfg)
+	if err != nil {
+		return err
+	}
+
+	app.Config = cfg.(*Config)
+
+	return nil
+}
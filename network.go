@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/yaegashi/customazed/utils/azutil"
+	"github.com/yaegashi/customazed/utils/ssutil"
+
+	"github.com/Azure/azure-sdk-for-go/profiles/2020-09-01/resources/mgmt/resources"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-03-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func (app *App) Subnet(ctx context.Context) (*network.Subnet, error) {
+	if app._Subnet == nil {
+		err := app.VNetGet(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return app._Subnet, nil
+}
+
+func (app *App) VNetValid() bool {
+	cfg := app.Config.VNet
+	if cfg.SubnetID != "" {
+		return true
+	}
+	if ssutil.HasEmpty(cfg.ResourceGroup, cfg.VNetName, cfg.SubnetName) {
+		app.Log("VNet: missing configuration")
+		return false
+	}
+	return true
+}
+
+// VNetSubnetNames returns subscription ID, resource group, virtual network and subnet names
+func (app *App) VNetSubnetNames() (string, string, string, string, error) {
+	cfg := app.Config.VNet
+	if cfg.SubnetID == "" {
+		return app.Config.SubscriptionID, cfg.ResourceGroup, cfg.VNetName, cfg.SubnetName, nil
+	}
+	// /subscriptions/{sub}/resourceGroups/{rg}/providers/Microsoft.Network/virtualNetworks/{vnet}/subnets/{subnet}
+	parts := strings.Split(strings.Trim(cfg.SubnetID, "/"), "/")
+	if len(parts) != 10 || !strings.EqualFold(parts[0], "subscriptions") || !strings.EqualFold(parts[2], "resourceGroups") || !strings.EqualFold(parts[6], "virtualNetworks") || !strings.EqualFold(parts[8], "subnets") {
+		return "", "", "", "", fmt.Errorf("invalid subnet ID: %s", cfg.SubnetID)
+	}
+	return parts[1], parts[3], parts[7], parts[9], nil
+}
+
+func (app *App) VNetGet(ctx context.Context) error {
+	if !app.VNetValid() {
+		return nil
+	}
+
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	subscriptionID, groupName, vnetName, subnetName, err := app.VNetSubnetNames()
+	if err != nil {
+		return err
+	}
+
+	subnetsClient := network.NewSubnetsClient(subscriptionID)
+	subnetsClient.Authorizer = authorizer
+	subnet, err := subnetsClient.Get(ctx, groupName, vnetName, subnetName, "")
+	if err != nil {
+		return err
+	}
+
+	app._Subnet = &subnet
+
+	app.Config.VNet.SubnetID = *subnet.ID
+	return nil
+}
+
+func (app *App) VNetSetup(ctx context.Context) error {
+	if !app.VNetValid() {
+		return nil
+	}
+
+	if app.Config.VNet.SkipSetup {
+		app.Logf("VNet: skipping setup")
+		return nil
+	}
+
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	subscriptionID, groupName, vnetName, subnetName, err := app.VNetSubnetNames()
+	if err != nil {
+		return err
+	}
+
+	subnetsClient := network.NewSubnetsClient(subscriptionID)
+	subnetsClient.Authorizer = authorizer
+	subnet, err := subnetsClient.Get(ctx, groupName, vnetName, subnetName, "")
+	if err == nil {
+		// Bring-your-own subnet: validate only
+		app.Logf("VNet: validating subnet: %s", *subnet.ID)
+		if p := subnet.SubnetPropertiesFormat; p == nil || p.PrivateLinkServiceNetworkPolicies != network.VirtualNetworkPrivateLinkServiceNetworkPoliciesDisabled {
+			return fmt.Errorf("subnet %s must have privateLinkServiceNetworkPolicies disabled for image builder", subnetName)
+		}
+		app._Subnet = &subnet
+		app.Config.VNet.SubnetID = *subnet.ID
+		return nil
+	}
+	if aErr := azutil.Error(err); aErr == nil || aErr.StatusCode != http.StatusNotFound {
+		return err
+	}
+
+	cfg := app.Config.VNet
+	if ssutil.HasEmpty(cfg.Location, cfg.SubnetPrefix) {
+		return fmt.Errorf("subnet %s not found: specify location and subnetPrefix to create it", subnetName)
+	}
+
+	app.Logf("VNet: creating resource group: %s", groupName)
+	groupsClient := resources.NewGroupsClient(subscriptionID)
+	groupsClient.Authorizer = authorizer
+	groupTags, err := app.GroupTags(ctx, groupsClient, groupName, cfg.Tags)
+	if err != nil {
+		return err
+	}
+	groupsParams := resources.Group{
+		Location: &cfg.Location,
+		Tags:     groupTags,
+	}
+	_, err = groupsClient.CreateOrUpdate(ctx, groupName, groupsParams)
+	if err != nil {
+		return err
+	}
+
+	vnetsClient := network.NewVirtualNetworksClient(subscriptionID)
+	vnetsClient.Authorizer = authorizer
+	_, err = vnetsClient.Get(ctx, groupName, vnetName, "")
+	if err != nil {
+		if aErr := azutil.Error(err); aErr == nil || aErr.StatusCode != http.StatusNotFound {
+			return err
+		}
+		if cfg.AddressPrefix == "" {
+			return fmt.Errorf("virtual network %s not found: specify addressPrefix to create it", vnetName)
+		}
+		app.Logf("VNet: creating virtual network: %s", vnetName)
+		vnetParams := network.VirtualNetwork{
+			Location: &cfg.Location,
+			Tags:     app.Tags(cfg.Tags),
+			VirtualNetworkPropertiesFormat: &network.VirtualNetworkPropertiesFormat{
+				AddressSpace: &network.AddressSpace{AddressPrefixes: &[]string{cfg.AddressPrefix}},
+			},
+		}
+		vnetFuture, err := vnetsClient.CreateOrUpdate(ctx, groupName, vnetName, vnetParams)
+		if err != nil {
+			return err
+		}
+		err = vnetFuture.WaitForCompletionRef(ctx, vnetsClient.Client)
+		if err != nil {
+			return err
+		}
+	}
+
+	app.Logf("VNet: creating subnet: %s", subnetName)
+	subnetParams := network.Subnet{
+		SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+			AddressPrefix:                     to.StringPtr(cfg.SubnetPrefix),
+			PrivateLinkServiceNetworkPolicies: network.VirtualNetworkPrivateLinkServiceNetworkPoliciesDisabled,
+		},
+	}
+	subnetFuture, err := subnetsClient.CreateOrUpdate(ctx, groupName, vnetName, subnetName, subnetParams)
+	if err != nil {
+		return err
+	}
+	err = subnetFuture.WaitForCompletionRef(ctx, subnetsClient.Client)
+	if err != nil {
+		return err
+	}
+	subnet, err = subnetFuture.Result(subnetsClient)
+	if err != nil {
+		return err
+	}
+
+	app._Subnet = &subnet
+	app.Config.VNet.SubnetID = *subnet.ID
+	return nil
+}
@@ -17,12 +17,14 @@ const (
 	RoleNameStorageBlobDataOwner       = "b7e6dc6d-f1e8-4753-8033-0f276bb0955b"
 	RoleNameStorageBlobDataReader      = "2a2b9908-6ea1-4ae2-8e65-a410df84e7d1"
 	RoleNameStorageBlobDataDelegator   = "db58b8e5-c6ad-4a2a-8342-4190687cbf4a"
+	RoleNameNetworkContributor         = "4d97b98b-1d4f-4787-a291-c67834d212e7"
 	RoleNameImageCreatorNamespace      = "d3d5cf35-0954-4711-b01a-faa4800979d5"
 )
 
 func (app *App) RoleSetup(ctx context.Context) error {
-	roleID := func(name string) *string {
-		s := fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Authorization/roleDefinitions/%s", app.Config.SubscriptionID, name)
+	// Role definition ID must be in the subscription of the assignment scope
+	roleID := func(subscriptionID, name string) *string {
+		s := fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Authorization/roleDefinitions/%s", subscriptionID, name)
 		return &s
 	}
 
@@ -51,6 +53,11 @@ func (app *App) RoleSetup(ctx context.Context) error {
 		return err
 	}
 
+	subnet, err := app.Subnet(ctx)
+	if err != nil {
+		return err
+	}
+
 	authorizer, err := app.ARMAuthorizer()
 	if err != nil {
 		return err
@@ -73,7 +80,7 @@ func (app *App) RoleSetup(ctx context.Context) error {
 			app.Logf("Role: assign role to user for blob container")
 			roleAssignmentParams := authorization.RoleAssignmentCreateParameters{
 				RoleAssignmentProperties: &authorization.RoleAssignmentProperties{
-					RoleDefinitionID: roleID(RoleNameStorageBlobDataOwner),
+					RoleDefinitionID: roleID(app.Config.SubscriptionID, RoleNameStorageBlobDataOwner),
 					PrincipalID:      &oid,
 				},
 			}
@@ -88,7 +95,7 @@ func (app *App) RoleSetup(ctx context.Context) error {
 			app.Logf("Role: assign role to identity for blob container")
 			roleAssignmentParams := authorization.RoleAssignmentCreateParameters{
 				RoleAssignmentProperties: &authorization.RoleAssignmentProperties{
-					RoleDefinitionID: roleID(RoleNameStorageBlobDataReader),
+					RoleDefinitionID: roleID(app.Config.SubscriptionID, RoleNameStorageBlobDataReader),
 					PrincipalID:      to.StringPtr(identity.PrincipalID.String()),
 				},
 			}
@@ -103,7 +110,7 @@ func (app *App) RoleSetup(ctx context.Context) error {
 			app.Logf("Role: assign role to machine for blob container")
 			roleAssignmentParams := authorization.RoleAssignmentCreateParameters{
 				RoleAssignmentProperties: &authorization.RoleAssignmentProperties{
-					RoleDefinitionID: roleID(RoleNameStorageBlobDataReader),
+					RoleDefinitionID: roleID(app.Config.SubscriptionID, RoleNameStorageBlobDataReader),
 					PrincipalID:      machine.Identity.PrincipalID,
 				},
 			}
@@ -174,6 +181,25 @@ func (app *App) RoleSetup(ctx context.Context) error {
 				}
 			}
 		}
+		if subnet != nil {
+			app.Logf("Role: assign role to identity for subnet")
+			subnetSubscriptionID, _, _, _, err := app.VNetSubnetNames()
+			if err != nil {
+				return err
+			}
+			roleAssignmentParams := authorization.RoleAssignmentCreateParameters{
+				RoleAssignmentProperties: &authorization.RoleAssignmentProperties{
+					RoleDefinitionID: roleID(subnetSubscriptionID, RoleNameNetworkContributor),
+					PrincipalID:      to.StringPtr(identity.PrincipalID.String()),
+				},
+			}
+			_, err = roleAssignmentsClient.Create(ctx, *subnet.ID, uuid.New().String(), roleAssignmentParams)
+			if err != nil {
+				if aErr := azutil.Error(err); aErr == nil || aErr.ServiceError.Code != "RoleAssignmentExists" {
+					return err
+				}
+			}
+		}
 	}
 
 	return nil
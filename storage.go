@@ -89,8 +89,13 @@ func (app *App) StorageSetup(ctx context.Context) error {
 	app.Logf("Storage: creating resource group: %s", app.Config.Storage.ResourceGroup)
 	groupsClient := resources.NewGroupsClient(app.Config.SubscriptionID)
 	groupsClient.Authorizer = authorizer
+	groupTags, err := app.GroupTags(ctx, groupsClient, app.Config.Storage.ResourceGroup, app.Config.Storage.Tags)
+	if err != nil {
+		return err
+	}
 	groupsParams := resources.Group{
 		Location: &app.Config.Storage.Location,
+		Tags:     groupTags,
 	}
 	_, err = groupsClient.CreateOrUpdate(ctx, app.Config.Storage.ResourceGroup, groupsParams)
 	if err != nil {
@@ -100,10 +105,16 @@ func (app *App) StorageSetup(ctx context.Context) error {
 	app.Logf("Storage: creating storage account: %s", app.Config.Storage.AccountName)
 	accountsClient := storage.NewAccountsClient(app.Config.SubscriptionID)
 	accountsClient.Authorizer = authorizer
+	account, err := accountsClient.GetProperties(ctx, app.Config.Storage.ResourceGroup, app.Config.Storage.AccountName, "")
+	accountTags, err := ExistingTags(account.Tags, err)
+	if err != nil {
+		return err
+	}
 	accountsParams := storage.AccountCreateParameters{
 		Location: &app.Config.Storage.Location,
 		Kind:     "StorageV2",
 		Sku:      &storage.Sku{Name: "Standard_LRS"},
+		Tags:     MergeTags(accountTags, app.Tags(app.Config.Storage.Tags)),
 	}
 	accountFuture, err := accountsClient.Create(ctx, app.Config.Storage.ResourceGroup, app.Config.Storage.AccountName, accountsParams)
 	if err != nil {
@@ -134,6 +145,7 @@ type StorageUploader interface {
 	Valid() bool
 	Files() int
 	Add(s string) (string, error)
+	Uploads() map[string]string
 	Execute(ctx context.Context) error
 }
 
@@ -142,6 +154,7 @@ type DisabledStorageUploader string
 func (d DisabledStorageUploader) Valid() bool                       { return false }
 func (d DisabledStorageUploader) Files() int                        { return 0 }
 func (d DisabledStorageUploader) Add(s string) (string, error)      { return "", errors.New(string(d)) }
+func (d DisabledStorageUploader) Uploads() map[string]string        { return nil }
 func (d DisabledStorageUploader) Execute(ctx context.Context) error { return errors.New(string(d)) }
 
 type BlobStorageUploader struct {
@@ -182,6 +195,9 @@ func (su *BlobStorageUploader) path(p string) string {
 func (su *BlobStorageUploader) Valid() bool { return su.valid }
 func (su *BlobStorageUploader) Files() int  { return len(su.uploadMap) }
 
+// Uploads returns blob URLs of local files to upload
+func (su *BlobStorageUploader) Uploads() map[string]string { return su.uploadMap }
+
 func (su *BlobStorageUploader) Add(p string) (string, error) {
 	stringBlobURL, ok := su.uploadMap[p]
 	if !ok {
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/yaegashi/customazed/utils/azutil"
+
+	"github.com/Azure/azure-sdk-for-go/profiles/2020-09-01/resources/mgmt/resources"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// Tags set automatically on resources created by customazed
+const (
+	TagCreatedBy      = "createdBy"
+	TagCreatedAt      = "createdAt"
+	TagConfigID       = "customazedId"
+	TagCreatedByValue = "customazed"
+	TagSourceImage    = "sourceImage"
+	TagManifestSHA256 = "manifestSha256"
+)
+
+// ConfigTags returns resource tags merging common tags and section tags
+func (app *App) ConfigTags(sectionTags map[string]string) map[string]*string {
+	tags := map[string]*string{}
+	for k, v := range app.Config.Tags {
+		tags[k] = to.StringPtr(v)
+	}
+	for k, v := range sectionTags {
+		tags[k] = to.StringPtr(v)
+	}
+	return tags
+}
+
+// Tags returns resource tags merging common tags, section tags and automatic tags
+func (app *App) Tags(sectionTags map[string]string) map[string]*string {
+	tags := app.ConfigTags(sectionTags)
+	tags[TagCreatedBy] = to.StringPtr(TagCreatedByValue)
+	if app.Config.ID != "" {
+		tags[TagConfigID] = to.StringPtr(app.Config.ID)
+	}
+	return tags
+}
+
+// MergeTags returns existing tags overridden by tags
+func MergeTags(existing, tags map[string]*string) map[string]*string {
+	merged := map[string]*string{}
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return merged
+}
+
+// ExistingTags returns tags of the resource got with err, or nil if it is not found
+func ExistingTags(tags map[string]*string, err error) (map[string]*string, error) {
+	if err == nil {
+		return tags, nil
+	}
+	if aErr := azutil.Error(err); aErr != nil && aErr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	return nil, err
+}
+
+// GroupTags returns tags for resource group to create, or configured tags merged into tags of the existing one.
+// Automatic tags are set only on creation so as not to claim ownership of existing resource groups.
+func (app *App) GroupTags(ctx context.Context, groupsClient resources.GroupsClient, name string, sectionTags map[string]string) (map[string]*string, error) {
+	group, err := groupsClient.Get(ctx, name)
+	if err == nil {
+		return MergeTags(group.Tags, app.ConfigTags(sectionTags)), nil
+	}
+	if _, err := ExistingTags(nil, err); err != nil {
+		return nil, err
+	}
+	return app.Tags(sectionTags), nil
+}
@@ -2,11 +2,21 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 	"text/template"
 
+	"github.com/yaegashi/customazed/utils/hashutil"
+	"github.com/yaegashi/customazed/utils/inlineutil"
+	"github.com/yaegashi/customazed/utils/inpututil"
 	"github.com/yaegashi/customazed/utils/reflectutil"
+	"github.com/yaegashi/customazed/utils/ssutil"
 )
 
 type TemplateVariable struct {
@@ -41,6 +51,44 @@ func (app *App) NewTemplateVariable(su StorageUploader) *TemplateVariable {
 			return "", fmt.Errorf("environment variable %q not found", key)
 		}),
 		"hash": func(s ...string) string { return app.HashID(s...) },
+		"inlineFile": func(key string) string {
+			// File contents are not executed as templates
+			b, err := ioutil.ReadFile(key)
+			s := ""
+			if err == nil {
+				s, err = inlineutil.Marshal(string(b))
+			}
+			if err != nil {
+				if tv.err == nil {
+					tv.err = err
+				}
+				return fmt.Sprintf("<ERROR:%s>", err)
+			}
+			return s
+		},
+		"cell": func() string {
+			if app.MatrixCell == nil {
+				return ""
+			}
+			return app.MatrixCell.Name
+		},
+	}
+	// Patterns are joined with NUL to be passed as a single key
+	hashFilesFunc := tv.NewFunc("hashFiles", func(key string) (string, error) {
+		return hashFiles(strings.Split(key, "\x00"))
+	})
+	tv.funcMap["hashFiles"] = func(patterns ...string) string {
+		return hashFilesFunc(strings.Join(patterns, "\x00"))
+	}
+	inputsHash := tv.NewFunc("inputsHash", func(input string) (string, error) {
+		return app.InputsHash(input)
+	})
+	tv.funcMap["inputsHash"] = func(inputs ...string) string {
+		input := ssutil.FirstNonEmpty(app.BuilderInput, defaultBuilderInput)
+		if len(inputs) > 0 {
+			input = inputs[0]
+		}
+		return inputsHash(input)
 	}
 	tv.funcMap["id"] = func() string { return tv.funcMap["cfg"].(func(string) string)("id") }
 	tv.funcMap["prefix"] = func() string { return tv.funcMap["cfg"].(func(string) string)("storage.prefix") }
@@ -114,3 +162,93 @@ func (tv *TemplateVariable) Resolve(v interface{}) error {
 	})
 	return tmpErr
 }
+
+func hashFiles(patterns []string) (string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := hashutil.Glob(pattern)
+		if err != nil {
+			return "", err
+		}
+		if len(matches) == 0 {
+			return "", fmt.Errorf("no files matching %q", pattern)
+		}
+		files = append(files, matches...)
+	}
+	return hashutil.HashFiles(files)
+}
+
+// inputsStorageUploader collects files to upload without uploading them
+type inputsStorageUploader struct {
+	uploads map[string]string
+}
+
+func (su *inputsStorageUploader) Valid() bool                       { return false }
+func (su *inputsStorageUploader) Files() int                        { return len(su.uploads) }
+func (su *inputsStorageUploader) Add(p string) (string, error)      { su.uploads[p] = p; return p, nil }
+func (su *inputsStorageUploader) Uploads() map[string]string        { return su.uploads }
+func (su *inputsStorageUploader) Execute(ctx context.Context) error { return nil }
+
+// InputsHash returns SHA-256 hex digest of the resolved builder input and the content of files uploaded by it
+func (app *App) InputsHash(input string) (string, error) {
+	if app._InputsHashing {
+		return "", fmt.Errorf("cyclic reference to inputsHash in %s", input)
+	}
+	app._InputsHashing = true
+	defer func() { app._InputsHashing = false }()
+
+	var v interface{}
+	err := inpututil.UnmarshalJSONC(input, &v)
+	if err != nil {
+		return "", err
+	}
+	su := &inputsStorageUploader{uploads: map[string]string{}}
+	tv := app.NewTemplateVariable(su)
+	v, err = tv.resolveJSON(v)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	var files []string
+	for p := range su.uploads {
+		files = append(files, p)
+	}
+	filesHash, err := hashutil.HashFiles(files)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write(b)
+	fmt.Fprintf(h, "\n%s\n", filesHash)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// resolveJSON resolves template variables in strings of generic JSON value
+func (tv *TemplateVariable) resolveJSON(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case string:
+		return tv.Execute(x)
+	case []interface{}:
+		for i := range x {
+			y, err := tv.resolveJSON(x[i])
+			if err != nil {
+				return nil, err
+			}
+			x[i] = y
+		}
+	case map[string]interface{}:
+		for k := range x {
+			y, err := tv.resolveJSON(x[k])
+			if err != nil {
+				return nil, err
+			}
+			x[k] = y
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInputsHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "customazed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	write := func(name, content string) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("input.json", `{
+  // comments are allowed
+  "properties": {"customize": [{"type": "Shell", "scriptUri": "{{upload `+"`setup.sh`"+`}}"}]}
+}`)
+	write("setup.sh", "echo hello\n")
+	write("cyclic.json", `{"tags": {"inputs": "{{inputsHash `+"`cyclic.json`"+`}}"}}`)
+
+	app := &App{ConfigLoad: &Config{}}
+	h1, err := app.InputsHash("input.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := app.InputsHash("input.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h1 != h2 {
+		t.Errorf("hash is not stable: %s != %s", h1, h2)
+	}
+
+	write("setup.sh", "echo world\n")
+	h3, err := app.InputsHash("input.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h3 == h1 {
+		t.Errorf("hash did not change after modifying uploaded file: %s", h3)
+	}
+
+	// Without argument, inputsHash hashes the active builder input
+	app.BuilderInput = "input.json"
+	h4, err := app.NewTemplateVariable(nil).Execute("{{inputsHash}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h4 != h3 {
+		t.Errorf("inputsHash = %s, want %s", h4, h3)
+	}
+
+	_, err = app.InputsHash("cyclic.json")
+	if err == nil || !strings.Contains(err.Error(), "cyclic") {
+		t.Errorf("expected cyclic reference error, got %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package azutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ImageID is parsed resource ID of managed image or gallery image version
+type ImageID struct {
+	SubscriptionID   string
+	ResourceGroup    string
+	ImageName        string
+	GalleryName      string
+	GalleryImageName string
+	Version          string
+}
+
+// IsGalleryImageVersion reports whether id is a gallery image version
+func (id *ImageID) IsGalleryImageVersion() bool {
+	return id.GalleryName != ""
+}
+
+// ParseImageID parses resource ID of managed image or gallery image version
+func ParseImageID(s string) (*ImageID, error) {
+	// /subscriptions/{sub}/resourceGroups/{rg}/providers/Microsoft.Compute/images/{image}
+	// /subscriptions/{sub}/resourceGroups/{rg}/providers/Microsoft.Compute/galleries/{gallery}/images/{image}/versions/{version}
+	parts := strings.Split(strings.Trim(s, "/"), "/")
+	for _, p := range parts {
+		if p == "" {
+			return nil, fmt.Errorf("invalid image ID: %s", s)
+		}
+	}
+	isCompute := len(parts) >= 8 && strings.EqualFold(parts[0], "subscriptions") && strings.EqualFold(parts[2], "resourceGroups") && strings.EqualFold(parts[4], "providers") && strings.EqualFold(parts[5], "Microsoft.Compute")
+	switch {
+	case isCompute && len(parts) == 8 && strings.EqualFold(parts[6], "images"):
+		return &ImageID{SubscriptionID: parts[1], ResourceGroup: parts[3], ImageName: parts[7]}, nil
+	case isCompute && len(parts) == 12 && strings.EqualFold(parts[6], "galleries") && strings.EqualFold(parts[8], "images") && strings.EqualFold(parts[10], "versions"):
+		return &ImageID{SubscriptionID: parts[1], ResourceGroup: parts[3], GalleryName: parts[7], GalleryImageName: parts[9], Version: parts[11]}, nil
+	}
+	return nil, fmt.Errorf("invalid image ID: %s", s)
+}
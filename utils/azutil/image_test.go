@@ -0,0 +1,46 @@
+package azutil_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yaegashi/customazed/utils/azutil"
+)
+
+func TestParseImageID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want *azutil.ImageID
+	}{
+		{
+			"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/images/img",
+			&azutil.ImageID{SubscriptionID: "sub", ResourceGroup: "rg", ImageName: "img"},
+		},
+		{
+			"/subscriptions/sub/resourcegroups/rg/providers/microsoft.compute/galleries/gal/images/def/versions/1.2.3",
+			&azutil.ImageID{SubscriptionID: "sub", ResourceGroup: "rg", GalleryName: "gal", GalleryImageName: "def", Version: "1.2.3"},
+		},
+		{"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gal/images/def", nil},
+		{"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/images/img", nil},
+		{"/subscriptions/sub/resourceGroups//providers/Microsoft.Compute/images/img", nil},
+		{"gallery:rg/gal/def@latest", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := azutil.ParseImageID(tt.id)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("ParseImageID(%q) = %+v, want error", tt.id, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseImageID(%q): %s", tt.id, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseImageID(%q) = %+v, want %+v", tt.id, got, tt.want)
+		}
+		if got != nil && got.IsGalleryImageVersion() != (tt.want.GalleryName != "") {
+			t.Errorf("ParseImageID(%q).IsGalleryImageVersion() = %v", tt.id, got.IsGalleryImageVersion())
+		}
+	}
+}
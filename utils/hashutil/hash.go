@@ -0,0 +1,122 @@
+package hashutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Glob returns files matching the slash-separated pattern.
+// In addition to filepath.Match syntax, "**" matches any number of directories.
+func Glob(pattern string) ([]string, error) {
+	pattern = path.Clean(filepath.ToSlash(pattern))
+	if !strings.Contains(pattern, "**") {
+		matches, err := filepath.Glob(filepath.FromSlash(pattern))
+		if err != nil {
+			return nil, err
+		}
+		var files []string
+		for _, m := range matches {
+			if fi, err := os.Stat(m); err == nil && !fi.IsDir() {
+				files = append(files, filepath.ToSlash(m))
+			}
+		}
+		sort.Strings(files)
+		return files, nil
+	}
+	// Walk from the longest directory prefix without wildcards
+	root := "."
+	segments := strings.Split(pattern, "/")
+	for i, s := range segments {
+		if strings.ContainsAny(s, "*?[") {
+			if i > 0 {
+				root = strings.Join(segments[:i], "/")
+			}
+			break
+		}
+	}
+	if pattern[0] == '/' && root == "." {
+		root = "/"
+	}
+	var files []string
+	err := filepath.Walk(filepath.FromSlash(root), func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		p = filepath.ToSlash(p)
+		ok, err := Match(pattern, p)
+		if err != nil {
+			return err
+		}
+		if ok {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Match reports whether slash-separated name matches the pattern with "**" support
+func Match(pattern, name string) (bool, error) {
+	return match(strings.Split(path.Clean(pattern), "/"), strings.Split(path.Clean(name), "/"))
+}
+
+func match(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				ok, err := match(pattern[1:], name[i:])
+				if err != nil || ok {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
+
+// HashFiles returns SHA-256 hex digest of names and contents of files in sorted order
+func HashFiles(files []string) (string, error) {
+	sorted := append([]string{}, files...)
+	sort.Strings(sorted)
+	h := sha256.New()
+	for _, name := range sorted {
+		f, err := os.Open(name)
+		if err != nil {
+			return "", err
+		}
+		fh := sha256.New()
+		_, err = io.Copy(fh, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%x  %s\n", fh.Sum(nil), filepath.ToSlash(name))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,98 @@
+package hashutil_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/yaegashi/customazed/utils/hashutil"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"scripts/**", "scripts/a.sh", true},
+		{"scripts/**", "scripts/sub/b.sh", true},
+		{"scripts/**", "other/a.sh", false},
+		{"scripts/**/*.sh", "scripts/a.sh", true},
+		{"scripts/**/*.sh", "scripts/x/y/a.sh", true},
+		{"scripts/**/*.sh", "scripts/x/a.ps1", false},
+		{"**/*.ps1", "a/b/c.ps1", true},
+		{"scripts/*.sh", "scripts/sub/b.sh", false},
+	}
+	for _, tt := range tests {
+		got, err := hashutil.Match(tt.pattern, tt.name)
+		if err != nil {
+			t.Errorf("Match(%q, %q): %s", tt.pattern, tt.name, err)
+		} else if got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGlobHashFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hashutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"scripts/a.sh":     "echo a\n",
+		"scripts/sub/b.sh": "echo b\n",
+		"scripts/c.ps1":    "Write-Host c\n",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := hashutil.Glob("scripts/**/*.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"scripts/a.sh", "scripts/sub/b.sh"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("Glob() = %v, want %v", files, want)
+	}
+	files, err = hashutil.Glob("scripts/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"scripts/a.sh", "scripts/c.ps1"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("Glob() = %v, want %v", files, want)
+	}
+
+	h1, err := hashutil.HashFiles([]string{"scripts/a.sh", "scripts/sub/b.sh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := hashutil.HashFiles([]string{"scripts/sub/b.sh", "scripts/a.sh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h1 != h2 {
+		t.Errorf("hash depends on order: %s != %s", h1, h2)
+	}
+	if err := ioutil.WriteFile("scripts/a.sh", []byte("echo A\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h3, err := hashutil.HashFiles([]string{"scripts/a.sh", "scripts/sub/b.sh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h1 == h3 {
+		t.Errorf("hash does not change with content")
+	}
+}
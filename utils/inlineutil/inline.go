@@ -0,0 +1,53 @@
+package inlineutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// inlineFileRegexp matches a string consisting of a single inlineFile template action
+var inlineFileRegexp = regexp.MustCompile(`^\s*\{\{-?\s*inlineFile\s[^{}]*\}\}\s*$`)
+
+// IsInlineFile reports whether s consists of a single inlineFile template action
+func IsInlineFile(s string) bool {
+	return inlineFileRegexp.MatchString(s)
+}
+
+// Lines returns lines of script text with CRLF converted to LF
+func Lines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(text, "\n")
+}
+
+// Marshal returns JSON string array of lines of script text
+func Marshal(text string) (string, error) {
+	b, err := json.Marshal(Lines(text))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Expand replaces entries at marked indexes, which must be JSON string arrays, with their elements
+func Expand(entries []string, marked map[int]bool) ([]string, error) {
+	out := []string{}
+	for i, s := range entries {
+		if !marked[i] {
+			out = append(out, s)
+			continue
+		}
+		var lines []string
+		err := json.Unmarshal([]byte(s), &lines)
+		if err != nil {
+			return nil, fmt.Errorf("inline entry %d: %s", i, err)
+		}
+		out = append(out, lines...)
+	}
+	return out, nil
+}
@@ -0,0 +1,63 @@
+package inlineutil_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yaegashi/customazed/utils/inlineutil"
+)
+
+func TestIsInlineFile(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"{{inlineFile `scripts/setup.sh`}}", true},
+		{" {{- inlineFile \"scripts/setup.sh\" -}} ", true},
+		{"{{inlineFile (cfg `script`)}}", true},
+		{"echo {{inlineFile `scripts/setup.sh`}}", false},
+		{"{{inlineFile `a.sh`}}{{inlineFile `b.sh`}}", false},
+		{"{{upload `scripts/setup.sh`}}", false},
+		{"echo hello", false},
+	}
+	for _, tt := range tests {
+		if got := inlineutil.IsInlineFile(tt.s); got != tt.want {
+			t.Errorf("IsInlineFile(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"echo \"a\\tb\"\r\nexit 0\r\n", `["echo \"a\\tb\"","exit 0"]`},
+		{"one\n\nthree", `["one","","three"]`},
+		{"", `[]`},
+	}
+	for _, tt := range tests {
+		got, err := inlineutil.Marshal(tt.text)
+		if err != nil {
+			t.Errorf("Marshal(%q): %s", tt.text, err)
+		} else if got != tt.want {
+			t.Errorf("Marshal(%q) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	entries := []string{"set -e", `["apt-get update","echo \"done\""]`, "echo 'a\nb'", `["x"]`}
+	got, err := inlineutil.Expand(entries, map[int]bool{1: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"set -e", "apt-get update", `echo "done"`, "echo 'a\nb'", `["x"]`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expand() = %q, want %q", got, want)
+	}
+
+	_, err = inlineutil.Expand([]string{"not json"}, map[int]bool{0: true})
+	if err == nil {
+		t.Error("Expand() should fail for invalid JSON")
+	}
+}
@@ -0,0 +1,185 @@
+package jsondiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Kind is kind of change
+type Kind string
+
+// Kinds of change
+const (
+	Added   Kind = "+"
+	Removed Kind = "-"
+	Changed Kind = "~"
+)
+
+// Change is a difference at a path between two JSON values
+type Change struct {
+	Kind Kind
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("%s %s: %s", c.Kind, c.Path, Format(c.New))
+	case Removed:
+		return fmt.Sprintf("%s %s: %s", c.Kind, c.Path, Format(c.Old))
+	default:
+		return fmt.Sprintf("%s %s: %s -> %s", c.Kind, c.Path, Format(c.Old), Format(c.New))
+	}
+}
+
+// Format returns compact JSON representation of v
+func Format(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+// Normalize converts v into generic JSON value by round-tripping through JSON
+func Normalize(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	err = json.Unmarshal(b, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Delete removes the member at dot-separated path from generic JSON value v.
+// A "*" path element matches all members of an object or all elements of an array.
+func Delete(v interface{}, path string) {
+	_delete(v, strings.Split(path, "."))
+}
+
+func _delete(v interface{}, keys []string) {
+	if a, ok := v.([]interface{}); ok && len(keys) > 1 && keys[0] == "*" {
+		for _, e := range a {
+			_delete(e, keys[1:])
+		}
+		return
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok || len(keys) == 0 {
+		return
+	}
+	if keys[0] == "*" {
+		for k := range m {
+			if len(keys) == 1 {
+				delete(m, k)
+			} else {
+				_delete(m[k], keys[1:])
+			}
+		}
+		return
+	}
+	if len(keys) == 1 {
+		delete(m, keys[0])
+		return
+	}
+	_delete(m[keys[0]], keys[1:])
+}
+
+// Diff returns changes from generic JSON value a to b sorted by path
+func Diff(a, b interface{}) []Change {
+	var changes []Change
+	_diff("", a, b, &changes)
+	return changes
+}
+
+func _diff(path string, a, b interface{}, changes *[]Change) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := map[string]bool{}
+		for k := range av {
+			keys[k] = true
+		}
+		for k := range bv {
+			keys[k] = true
+		}
+		var sorted []string
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			ax, aok := av[k]
+			bx, bok := bv[k]
+			switch {
+			case !aok:
+				*changes = append(*changes, Change{Kind: Added, Path: p, New: bx})
+			case !bok:
+				*changes = append(*changes, Change{Kind: Removed, Path: p, Old: ax})
+			default:
+				_diff(p, ax, bx, changes)
+			}
+		}
+		return
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(av) || i < len(bv); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(av):
+				*changes = append(*changes, Change{Kind: Added, Path: p, New: bv[i]})
+			case i >= len(bv):
+				*changes = append(*changes, Change{Kind: Removed, Path: p, Old: av[i]})
+			default:
+				_diff(p, av[i], bv[i], changes)
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, Change{Kind: Changed, Path: path, Old: a, New: b})
+	}
+}
+
+// IsEmpty reports whether generic JSON value v is null, zero or empty
+func IsEmpty(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return true
+	case bool:
+		return !x
+	case float64:
+		return x == 0
+	case string:
+		return x == ""
+	case []interface{}:
+		return len(x) == 0
+	case map[string]interface{}:
+		for _, y := range x {
+			if !IsEmpty(y) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package jsondiff_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/yaegashi/customazed/utils/jsondiff"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	err := json.Unmarshal([]byte(s), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestDiff(t *testing.T) {
+	a := decode(t, `{"a":1,"b":{"c":"x","d":[1,2,3]},"e":true}`)
+	b := decode(t, `{"a":1,"b":{"c":"y","d":[1,2]},"f":null}`)
+	changes := jsondiff.Diff(a, b)
+	expected := []string{
+		`~ b.c: "x" -> "y"`,
+		`- b.d[2]: 3`,
+		`- e: true`,
+		`+ f: null`,
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("got %d changes, expected %d: %v", len(changes), len(expected), changes)
+	}
+	for i, c := range changes {
+		if c.String() != expected[i] {
+			t.Errorf("change %d: got %q, expected %q", i, c.String(), expected[i])
+		}
+	}
+}
+
+func TestDiffTypeMismatch(t *testing.T) {
+	a := decode(t, `{"a":{"b":1}}`)
+	b := decode(t, `{"a":[1]}`)
+	changes := jsondiff.Diff(a, b)
+	if len(changes) != 1 || changes[0].String() != `~ a: {"b":1} -> [1]` {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+}
+
+func TestDiffEqual(t *testing.T) {
+	a := decode(t, `{"a":[{"b":1},{"c":[2]}]}`)
+	b := decode(t, `{"a":[{"b":1},{"c":[2]}]}`)
+	if changes := jsondiff.Diff(a, b); len(changes) != 0 {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	v := decode(t, `{"a":{"b":1,"c":2},"d":{"x":{"id":1,"n":2},"y":{"id":3}},"e":[{"id":4,"n":5},6]}`)
+	jsondiff.Delete(v, "a.b")
+	jsondiff.Delete(v, "d.*.id")
+	jsondiff.Delete(v, "e.*.id")
+	jsondiff.Delete(v, "no.such.path")
+	got := jsondiff.Format(v)
+	expected := `{"a":{"c":2},"d":{"x":{"n":2},"y":{}},"e":[{"n":5},6]}`
+	if got != expected {
+		t.Errorf("got %s, expected %s", got, expected)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	type s struct {
+		A int    `json:"a"`
+		B string `json:"b,omitempty"`
+	}
+	v, err := jsondiff.Normalize(s{A: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := jsondiff.Diff(v, decode(t, `{"a":1}`)); len(changes) != 0 {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	for _, s := range []string{`null`, `false`, `0`, `""`, `[]`, `{}`, `{"a":0,"b":{"c":""}}`} {
+		if !jsondiff.IsEmpty(decode(t, s)) {
+			t.Errorf("%s should be empty", s)
+		}
+	}
+	for _, s := range []string{`true`, `1`, `"a"`, `[0]`, `{"a":{"b":1}}`} {
+		if jsondiff.IsEmpty(decode(t, s)) {
+			t.Errorf("%s should not be empty", s)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package packerlog
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Phase kinds
+const (
+	KindProvisioning = "provisioning"
+	KindCustomizer   = "customizer"
+	KindDistribution = "distribution"
+)
+
+var (
+	reTime     = regexp.MustCompile(`(\d{4})[/-](\d{2})[/-](\d{2})[ T](\d{2}):(\d{2}):(\d{2})`)
+	reStart    = regexp.MustCompile(`\(telemetry\) Starting provisioner (\S+)`)
+	reEnd      = regexp.MustCompile(`\(telemetry\) ending (\S+)`)
+	reErrored  = regexp.MustCompile(`Build '[^']*' errored`)
+	reErrorMsg = regexp.MustCompile(`(?:^|[\s:>])(?:Error|ERROR|FATAL|Fatal)\b`)
+)
+
+// Line is a line of Packer log
+type Line struct {
+	Time  time.Time
+	Text  string
+	Error bool
+}
+
+// Phase is a series of Packer log lines for a build step
+type Phase struct {
+	Kind   string
+	Name   string
+	Type   string
+	Start  time.Time
+	End    time.Time
+	Lines  []Line
+	Errors []Line
+}
+
+// Duration returns elapsed time of the phase
+func (p *Phase) Duration() time.Duration {
+	if p.Start.IsZero() || p.End.IsZero() {
+		return 0
+	}
+	return p.End.Sub(p.Start)
+}
+
+// Title returns the display name of the phase
+func (p *Phase) Title() string {
+	if p.Kind != KindCustomizer {
+		return p.Kind
+	}
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.Type
+}
+
+// Match reports whether the phase is a customizer matching name or type
+func (p *Phase) Match(name string) bool {
+	return p.Kind == KindCustomizer && (strings.EqualFold(p.Name, name) || strings.EqualFold(p.Type, name))
+}
+
+func (p *Phase) add(l Line) {
+	if !l.Time.IsZero() {
+		if p.Start.IsZero() {
+			p.Start = l.Time
+		}
+		p.End = l.Time
+	}
+	p.Lines = append(p.Lines, l)
+	if l.Error {
+		p.Errors = append(p.Errors, l)
+	}
+}
+
+// ParseLine parses a line of Packer log
+func ParseLine(text string) Line {
+	l := Line{Text: text}
+	if m := reTime.FindStringSubmatchIndex(text); m != nil && m[0] < 32 {
+		t, err := time.Parse("2006-01-02 15:04:05", strings.Join([]string{
+			text[m[2]:m[3]], "-", text[m[4]:m[5]], "-", text[m[6]:m[7]], " ",
+			text[m[8]:m[9]], ":", text[m[10]:m[11]], ":", text[m[12]:m[13]],
+		}, ""))
+		if err == nil {
+			l.Time = t
+		}
+	}
+	l.Error = strings.Contains(text, "PACKER ERR") ||
+		strings.Contains(text, "ui error:") ||
+		reErrored.MatchString(text) ||
+		reErrorMsg.MatchString(text)
+	return l
+}
+
+// Parse splits Packer log into phases.
+// Customizer phases are labeled with names in order if given.
+func Parse(r io.Reader, names []string) ([]*Phase, error) {
+	var phases []*Phase
+	cur := &Phase{Kind: KindProvisioning}
+	phases = append(phases, cur)
+	n := 0
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		l := ParseLine(s.Text())
+		if m := reStart.FindStringSubmatch(l.Text); m != nil {
+			cur = &Phase{Kind: KindCustomizer, Type: m[1]}
+			if n < len(names) {
+				cur.Name = names[n]
+			}
+			n++
+			phases = append(phases, cur)
+			cur.add(l)
+			continue
+		}
+		cur.add(l)
+		if m := reEnd.FindStringSubmatch(l.Text); m != nil && cur.Kind == KindCustomizer {
+			cur = &Phase{Kind: KindDistribution}
+			phases = append(phases, cur)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	// Drop empty or intermediate distribution phases between customizers
+	var result []*Phase
+	for i, p := range phases {
+		if p.Kind == KindDistribution && (len(p.Lines) == 0 || i < len(phases)-1) {
+			if len(p.Lines) > 0 && len(result) > 0 {
+				prev := result[len(result)-1]
+				for _, l := range p.Lines {
+					prev.add(l)
+				}
+			}
+			continue
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
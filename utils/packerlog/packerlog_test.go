@@ -0,0 +1,91 @@
+package packerlog_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yaegashi/customazed/utils/packerlog"
+)
+
+const testLog = `[abc] PACKER OUT 2021/10/15 01:00:00 ui: ==> azure-arm: Running builder ...
+[abc] PACKER OUT 2021/10/15 01:05:00 ui: ==> azure-arm: Waiting for SSH to become available...
+[abc] PACKER OUT 2021/10/15 01:06:00 ui: ==> azure-arm: (telemetry) Starting provisioner shell
+[abc] PACKER OUT 2021/10/15 01:06:10 ui:     azure-arm: hello
+[abc] PACKER OUT 2021/10/15 01:07:00 ui: ==> azure-arm: (telemetry) ending shell
+[abc] PACKER OUT 2021/10/15 01:07:30 ui: ==> azure-arm: (telemetry) Starting provisioner powershell
+[abc] PACKER OUT 2021/10/15 01:08:00 ui:     azure-arm: $ErrorActionPreference = "Stop"
+[abc] PACKER ERR 2021/10/15 01:09:00 ui error: ==> azure-arm: Script exited with non-zero exit status: 1
+[abc] PACKER OUT 2021/10/15 01:10:00 ui: ==> azure-arm: (telemetry) ending powershell
+[abc] PACKER OUT 2021/10/15 01:11:00 ui: ==> azure-arm: Deleting resource group ...
+[abc] PACKER ERR 2021/10/15 01:20:00 ui error: Build 'azure-arm' errored after 20 minutes
+`
+
+func TestParse(t *testing.T) {
+	phases, err := packerlog.Parse(strings.NewReader(testLog), []string{"Run setup script"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []struct {
+		title    string
+		lines    int
+		errors   int
+		duration time.Duration
+	}{
+		{title: "provisioning", lines: 2, errors: 0, duration: 5 * time.Minute},
+		{title: "Run setup script", lines: 3, errors: 0, duration: time.Minute},
+		{title: "powershell", lines: 4, errors: 1, duration: 150 * time.Second},
+		{title: "distribution", lines: 2, errors: 1, duration: 9 * time.Minute},
+	}
+	if len(phases) != len(exp) {
+		t.Fatalf("got %d phases, want %d", len(phases), len(exp))
+	}
+	for i, e := range exp {
+		p := phases[i]
+		if p.Title() != e.title {
+			t.Errorf("phase %d: got title %q, want %q", i, p.Title(), e.title)
+		}
+		if len(p.Lines) != e.lines {
+			t.Errorf("phase %d: got %d lines, want %d", i, len(p.Lines), e.lines)
+		}
+		if len(p.Errors) != e.errors {
+			t.Errorf("phase %d: got %d errors, want %d", i, len(p.Errors), e.errors)
+		}
+		if p.Duration() != e.duration {
+			t.Errorf("phase %d: got duration %s, want %s", i, p.Duration(), e.duration)
+		}
+	}
+	if !phases[1].Match("shell") || !phases[1].Match("run setup script") || phases[2].Match("shell") {
+		t.Errorf("unexpected match result")
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		text  string
+		time  string
+		error bool
+	}{
+		{text: "2021/10/15 01:02:03 ui: hello", time: "2021-10-15T01:02:03Z"},
+		{text: "[x] PACKER OUT 2021-10-15T01:02:03Z foo", time: "2021-10-15T01:02:03Z"},
+		{text: "no timestamp"},
+		{text: "azure-arm: Error: something failed", error: true},
+		{text: "azure-arm: $ErrorActionPreference = 'Stop'"},
+		{text: "PACKER ERR something", error: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			l := packerlog.ParseLine(tt.text)
+			got := ""
+			if !l.Time.IsZero() {
+				got = l.Time.Format(time.RFC3339)
+			}
+			if got != tt.time {
+				t.Errorf("got time %q, want %q", got, tt.time)
+			}
+			if l.Error != tt.error {
+				t.Errorf("got error %v, want %v", l.Error, tt.error)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package verutil
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Compare compares dot-separated versions numerically (e.g. "1.10.0" > "1.9.2").
+// Non-numeric components are compared as strings.
+func Compare(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xi, xErr := strconv.ParseUint(x, 10, 64)
+		yi, yErr := strconv.ParseUint(y, 10, 64)
+		switch {
+		case xErr == nil && yErr == nil:
+			if xi < yi {
+				return -1
+			}
+			if xi > yi {
+				return 1
+			}
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// Sort sorts versions in ascending order
+func Sort(versions []string) {
+	sort.SliceStable(versions, func(i, j int) bool { return Compare(versions[i], versions[j]) < 0 })
+}
+
+// Latest returns the latest version, or empty string if none
+func Latest(versions []string) string {
+	latest := ""
+	for _, v := range versions {
+		if latest == "" || Compare(v, latest) > 0 {
+			latest = v
+		}
+	}
+	return latest
+}
+
+// Match reports whether version satisfies constraint.
+// Constraint is space-separated conditions which all must be satisfied:
+// "latest" or "*" (any), "1.2.3" (exact), "1", "1.x", "1.2.x" (prefix),
+// "^1.2.3" (same major), "~1.2.3" (same minor), ">=1.2.3", ">1.2.3", "<=1.2.3", "<1.2.3", "=1.2.3".
+func Match(version, constraint string) (bool, error) {
+	for _, c := range strings.Fields(constraint) {
+		ok, err := match(version, c)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func match(version, c string) (bool, error) {
+	switch {
+	case c == "latest" || c == "*" || c == "x":
+		return true, nil
+	case strings.HasPrefix(c, ">="):
+		return Compare(version, c[2:]) >= 0, nil
+	case strings.HasPrefix(c, "<="):
+		return Compare(version, c[2:]) <= 0, nil
+	case strings.HasPrefix(c, ">"):
+		return Compare(version, c[1:]) > 0, nil
+	case strings.HasPrefix(c, "<"):
+		return Compare(version, c[1:]) < 0, nil
+	case strings.HasPrefix(c, "="):
+		return Compare(version, c[1:]) == 0, nil
+	case strings.HasPrefix(c, "^"), strings.HasPrefix(c, "~"):
+		base := strings.Split(c[1:], ".")
+		n := 1
+		if c[0] == '~' || base[0] == "0" {
+			n = 2
+		}
+		if len(base) < n {
+			return false, fmt.Errorf("invalid version constraint %q", c)
+		}
+		return Compare(version, c[1:]) >= 0 && hasPrefix(version, base[:n]), nil
+	}
+	parts := strings.Split(c, ".")
+	if last := parts[len(parts)-1]; last == "x" || last == "*" {
+		return hasPrefix(version, parts[:len(parts)-1]), nil
+	}
+	if len(parts) < 3 {
+		return hasPrefix(version, parts), nil
+	}
+	return Compare(version, c) == 0, nil
+}
+
+func hasPrefix(version string, prefix []string) bool {
+	parts := strings.Split(version, ".")
+	if len(parts) < len(prefix) {
+		return false
+	}
+	for i, p := range prefix {
+		if Compare(parts[i], p) != 0 {
+			return false
+		}
+	}
+	return true
+}
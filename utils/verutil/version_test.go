@@ -0,0 +1,87 @@
+package verutil_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yaegashi/customazed/utils/verutil"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.10.0", "1.9.2", 1},
+		{"1.2", "1.2.0", -1},
+		{"18.04.202109280", "18.04.202110130", -1},
+		{"2021.1.1", "2020.12.31", 1},
+		{"1.0.a", "1.0.b", -1},
+	}
+	for _, tt := range tests {
+		if got := verutil.Compare(tt.a, tt.b); got != tt.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := verutil.Compare(tt.b, tt.a); got != -tt.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestSortLatest(t *testing.T) {
+	versions := []string{"1.10.0", "1.2.0", "1.9.1", "0.1.0"}
+	if got := verutil.Latest(versions); got != "1.10.0" {
+		t.Errorf("Latest() = %q", got)
+	}
+	verutil.Sort(versions)
+	want := []string{"0.1.0", "1.2.0", "1.9.1", "1.10.0"}
+	if !reflect.DeepEqual(versions, want) {
+		t.Errorf("Sort() = %v, want %v", versions, want)
+	}
+	if got := verutil.Latest(nil); got != "" {
+		t.Errorf("Latest(nil) = %q", got)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		version, constraint string
+		want                bool
+	}{
+		{"1.2.3", "latest", true},
+		{"1.2.3", "*", true},
+		{"1.2.3", "1.2.3", true},
+		{"1.2.4", "1.2.3", false},
+		{"1.2.3", "1", true},
+		{"2.0.0", "1", false},
+		{"1.2.3", "1.x", true},
+		{"1.3.0", "1.2.x", false},
+		{"1.2.9", "1.2.x", true},
+		{"1.9.0", "^1.2.3", true},
+		{"1.2.2", "^1.2.3", false},
+		{"2.0.0", "^1.2.3", false},
+		{"0.2.5", "^0.2.3", true},
+		{"0.3.0", "^0.2.3", false},
+		{"1.2.9", "~1.2.3", true},
+		{"1.3.0", "~1.2.3", false},
+		{"1.5.0", ">=1.0.0 <2.0.0", true},
+		{"2.0.0", ">=1.0.0 <2.0.0", false},
+		{"1.0.0", ">1.0.0", false},
+		{"1.0.0", "<=1.0.0", true},
+		{"1.0.0", "=1.0.0", true},
+	}
+	for _, tt := range tests {
+		got, err := verutil.Match(tt.version, tt.constraint)
+		if err != nil {
+			t.Errorf("Match(%q, %q): %s", tt.version, tt.constraint, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.version, tt.constraint, got, tt.want)
+		}
+	}
+	if _, err := verutil.Match("1.0.0", "~1"); err == nil {
+		t.Errorf("Match with invalid constraint should fail")
+	}
+}
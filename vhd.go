@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/yaegashi/customazed/utils/ssutil"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2021-04-01/storage"
+	"github.com/Azure/azure-sdk-for-go/services/virtualmachineimagebuilder/mgmt/2020-02-14/virtualmachineimagebuilder"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+const VHDRunOutputName = "VHD"
+
+// VHDCopyConfigured reports whether VHD distribution and its copy destination are configured
+func (app *App) VHDCopyConfigured() bool {
+	return app.Config.VHD.Enabled && app.Config.VHD.BlobName != ""
+}
+
+// VHDCopyCheck returns error naming missing configuration for VHD copy
+func (app *App) VHDCopyCheck() error {
+	cfg := app.Config.VHD
+	switch {
+	case !cfg.Enabled:
+		return fmt.Errorf("VHD: vhd.enabled is not set")
+	case cfg.BlobName == "":
+		return fmt.Errorf("VHD: vhd.blobName is not configured")
+	case !app.StorageValid():
+		return fmt.Errorf("VHD: storage is not configured for copy destination")
+	}
+	return nil
+}
+
+// VHDArtifactURI returns the VHD URI from the image template run output
+func (app *App) VHDArtifactURI(ctx context.Context) (string, error) {
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return "", err
+	}
+
+	templatesClient := virtualmachineimagebuilder.NewVirtualMachineImageTemplatesClient(app.Config.SubscriptionID)
+	templatesClient.Authorizer = authorizer
+	runOutput, err := templatesClient.GetRunOutput(ctx, app.Config.Builder.ResourceGroup, app.Config.Builder.BuilderName, VHDRunOutputName)
+	if err != nil {
+		return "", err
+	}
+	if runOutput.RunOutputProperties == nil || runOutput.ArtifactURI == nil {
+		return "", fmt.Errorf("VHD: no artifact URI in run output %s", VHDRunOutputName)
+	}
+
+	return *runOutput.ArtifactURI, nil
+}
+
+// VHDCopy copies the VHD blob to the configured storage container by server-side copy
+func (app *App) VHDCopy(ctx context.Context, artifactURI string) (string, error) {
+	err := app.VHDCopyCheck()
+	if err != nil {
+		return "", err
+	}
+
+	authorizer, err := app.ARMAuthorizer()
+	if err != nil {
+		return "", err
+	}
+
+	srcURL, err := url.Parse(artifactURI)
+	if err != nil {
+		return "", err
+	}
+
+	// Sign the source URL with the key of the staging storage account
+	if srcURL.RawQuery == "" {
+		srcParts := azblob.NewBlobURLParts(*srcURL)
+		accountName := strings.SplitN(srcParts.Host, ".", 2)[0]
+		group, err := app.BuilderStagingGroup(ctx)
+		if err != nil {
+			return "", err
+		}
+		account, err := app.BuilderStagingAccount(ctx, group)
+		if err != nil {
+			return "", err
+		}
+		if !strings.EqualFold(*account.Name, accountName) {
+			return "", fmt.Errorf("VHD: storage account %s not found in %s", accountName, *group.Name)
+		}
+		accountsClient := storage.NewAccountsClient(app.Config.SubscriptionID)
+		accountsClient.Authorizer = authorizer
+		keyResult, err := accountsClient.ListKeys(ctx, *group.Name, *account.Name, "")
+		if err != nil {
+			return "", err
+		}
+		credential, err := azblob.NewSharedKeyCredential(*account.Name, *(*keyResult.Keys)[0].Value)
+		if err != nil {
+			return "", err
+		}
+		sasValues := azblob.BlobSASSignatureValues{
+			Protocol:      azblob.SASProtocolHTTPS,
+			ExpiryTime:    time.Now().UTC().Add(24 * time.Hour),
+			Permissions:   azblob.BlobSASPermissions{Read: true}.String(),
+			ContainerName: srcParts.ContainerName,
+			BlobName:      srcParts.BlobName,
+		}
+		srcParts.SAS, err = sasValues.NewSASQueryParameters(credential)
+		if err != nil {
+			return "", err
+		}
+		u := srcParts.URL()
+		srcURL = &u
+	}
+
+	token, err := app.StorageToken()
+	if err != nil {
+		return "", err
+	}
+
+	dstAccount, err := app.StorageAccount(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	p := azblob.NewPipeline(azblob.NewTokenCredential(token.OAuthToken(), nil), azblob.PipelineOptions{})
+	endpointURL, _ := url.Parse(*dstAccount.PrimaryEndpoints.Blob)
+	serviceURL := azblob.NewServiceURL(*endpointURL, p)
+	containerName := ssutil.FirstNonEmpty(app.Config.VHD.ContainerName, app.Config.Storage.ContainerName)
+	blobURL := serviceURL.NewContainerURL(containerName).NewBlobURL(app.Config.VHD.BlobName)
+
+	app.Logf("VHD: copying to %s", blobURL)
+	copyRes, err := blobURL.StartCopyFromURL(ctx, *srcURL, azblob.Metadata{}, azblob.ModifiedAccessConditions{}, azblob.BlobAccessConditions{}, azblob.DefaultAccessTier, nil)
+	if err != nil {
+		return "", err
+	}
+	status := copyRes.CopyStatus()
+	for status == azblob.CopyStatusPending {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(10 * time.Second):
+		}
+		propRes, err := blobURL.GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+		if err != nil {
+			return "", err
+		}
+		status = propRes.CopyStatus()
+		app.Logf("VHD: copy status %s (%s)", status, propRes.CopyProgress())
+	}
+	if status != azblob.CopyStatusSuccess {
+		return "", fmt.Errorf("VHD: copy %s", status)
+	}
+
+	return blobURL.String(), nil
+}